@@ -33,3 +33,73 @@ app.ports.storageGet.subscribe(function(key) {
   const value = localStorage.getItem(key);
   app.ports.storageGot.send(value);
 });
+
+// Messages are sent over a websocket, unless one can't be opened (for example
+// when a proxy breaks the upgrade), in which case they are received as
+// Server-Sent Events and each is sent with a POST.
+var socketPath = '/ws?protocol=2';
+var socketQueue = [];
+var socketSend = null;
+
+function flushSocket() {
+  while (socketSend && socketQueue.length > 0) {
+    socketSend(socketQueue.shift());
+  }
+}
+
+function connectWebSocket() {
+  var scheme = window.location.protocol === 'https:' ? 'wss://' : 'ws://';
+  var ws = new WebSocket(scheme + window.location.host + socketPath);
+  var opened = false;
+
+  ws.onopen = function() {
+    opened = true;
+    socketSend = function(data) { ws.send(data); };
+    flushSocket();
+  };
+
+  ws.onmessage = function(event) {
+    app.ports.sockReceive.send(event.data);
+  };
+
+  ws.onclose = function() {
+    socketSend = null;
+    if (opened) {
+      setTimeout(connectWebSocket, 1000);
+    } else {
+      connectEvents();
+    }
+  };
+}
+
+function connectEvents() {
+  var events = new EventSource(socketPath);
+
+  events.onmessage = function(event) {
+    var msg = JSON.parse(event.data);
+
+    // each stream starts by giving the key to POST messages with, the stream
+    // reconnects by itself and gets a new key
+    if (msg.op === 'session') {
+      var url = '/ws?session=' + encodeURIComponent(msg.data.session);
+      socketSend = function(data) {
+        fetch(url, { method: 'POST', body: data });
+      };
+      flushSocket();
+      return;
+    }
+
+    app.ports.sockReceive.send(event.data);
+  };
+
+  events.onerror = function() {
+    socketSend = null;
+  };
+}
+
+app.ports.sockSend.subscribe(function(data) {
+  socketQueue.push(data);
+  flushSocket();
+});
+
+connectWebSocket();
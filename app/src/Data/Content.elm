@@ -28,4 +28,6 @@ type alias Content =
     { id : Id
     , text : String
     , author : String
+    , version : Int
+    , draft : Maybe String
     }
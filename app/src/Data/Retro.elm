@@ -2,7 +2,7 @@ module Data.Retro exposing (..)
 
 import Data.Card as Card exposing (Card)
 import Data.Column as Column exposing (Column)
-import Data.Content exposing (Content)
+import Data.Content as Content exposing (Content)
 import Dict exposing (Dict)
 import EveryDict exposing (EveryDict)
 
@@ -111,7 +111,7 @@ addContent columnId cardId content =
                 List.map
                     (\x ->
                         if x.id == content.id then
-                            { x | text = content.text }
+                            { x | text = content.text, version = content.version }
                         else
                             x
                     )
@@ -122,6 +122,28 @@ addContent columnId cardId content =
     updateCard columnId cardId (\card -> { card | contents = contents card })
 
 
+updateContent : Column.Id -> Card.Id -> Content.Id -> (Content -> Content) -> Retro -> Retro
+updateContent columnId cardId contentId f =
+    let
+        updateHelp x =
+            if x.id == contentId then
+                f x
+            else
+                x
+    in
+    updateCard columnId cardId (\card -> { card | contents = List.map updateHelp card.contents })
+
+
+{-| Records that an edit was rejected because someone else changed the content
+first. The content is updated to their text, and the card is opened for editing
+again with the rejected text kept as a draft so that the two can be merged.
+-}
+conflictContent : Column.Id -> Card.Id -> Content.Id -> String -> Int -> String -> Retro -> Retro
+conflictContent columnId cardId contentId text version draft =
+    updateContent columnId cardId contentId (\x -> { x | text = text, version = version, draft = Just draft })
+        >> editingCard columnId cardId True
+
+
 groupCards : ( Column.Id, Card.Id ) -> ( Column.Id, Card.Id ) -> Retro -> Retro
 groupCards ( columnFrom, cardFrom ) ( columnTo, cardTo ) retro =
     let
@@ -31,14 +31,6 @@ type alias Flags =
     }
 
 
-webSocketUrl : Flags -> String
-webSocketUrl flags =
-    if flags.isSecure then
-        "wss://" ++ flags.host ++ "/ws"
-    else
-        "ws://" ++ flags.host ++ "/ws"
-
-
 
 -- Model
 
@@ -85,9 +77,9 @@ type Msg
     | RetroMsg Retro.Msg
 
 
-sockSender : Flags -> String -> String -> Sock.Sender msg
-sockSender flags userId token =
-    Sock.send (webSocketUrl flags) userId token
+sockSender : String -> String -> Sock.Sender msg
+sockSender userId token =
+    Sock.send userId token
 
 
 update : Msg -> Model -> ( Model, Cmd Msg )
@@ -98,7 +90,7 @@ update msg model =
                 Just ( userId, token ) ->
                     let
                         ( menuModel, menuMsg ) =
-                            Menu.update (sockSender model.flags userId token) subMsg model.menu
+                            Menu.update (sockSender userId token) subMsg model.menu
                     in
                     { model | menu = menuModel } ! [ Cmd.map MenuMsg menuMsg ]
 
@@ -110,7 +102,7 @@ update msg model =
                 Just ( userId, token ) ->
                     let
                         ( retroModel, retroMsg ) =
-                            Retro.update (sockSender model.flags userId token) subMsg model.retro
+                            Retro.update (sockSender userId token) subMsg model.retro
                     in
                     { model | retro = retroModel } ! [ Cmd.map RetroMsg retroMsg ]
 
@@ -187,7 +179,7 @@ runWithSockSender : Model -> (Sock.Sender msg -> Cmd msg) -> Cmd msg
 runWithSockSender model f =
     case Maybe.map2 (,) model.user model.token of
         Just ( userId, token ) ->
-            f (sockSender model.flags userId token)
+            f (sockSender userId token)
 
         Nothing ->
             Cmd.none
@@ -199,6 +191,9 @@ socketUpdate ( id, msgData ) model =
         Sock.Error { error } ->
             handleError error model
 
+        Sock.Ping ->
+            model ! [ runWithSockSender model Sock.pong ]
+
         _ ->
             model ! []
 
@@ -244,6 +239,6 @@ innerView userId model =
 subscriptions : Model -> Sub Msg
 subscriptions model =
     Sub.batch
-        [ Sock.listen (webSocketUrl model.flags) Socket
+        [ Sock.listen Socket
         , Port.storageGot SetId
         ]
@@ -95,8 +95,14 @@ update sender msg model =
         EditCard columnId cardId ->
             { model | retro = Retro.editingCard columnId cardId True model.retro } ! []
 
-        UpdateCard columnId cardId contentId ->
-            { model | input = "", retro = Retro.editingCard columnId cardId False model.retro } ! [ Sock.edit sender contentId columnId cardId model.input ]
+        UpdateCard columnId cardId contentId version ->
+            let
+                retro =
+                    model.retro
+                        |> Retro.editingCard columnId cardId False
+                        |> Retro.updateContent columnId cardId contentId (\x -> { x | draft = Nothing })
+            in
+            { model | input = "", retro = retro } ! [ Sock.edit sender contentId columnId cardId model.input version ]
 
         Navigate route ->
             model ! [ Route.navigate route ]
@@ -145,12 +151,14 @@ socketUpdate user ( id, msgData ) model =
             in
             { model | retro = Retro.addCard columnId card model.retro } ! []
 
-        Sock.Content { contentId, columnId, cardId, cardText } ->
+        Sock.Content { contentId, columnId, cardId, cardText, version } ->
             let
                 content =
                     { id = contentId
                     , text = cardText
                     , author = id
+                    , version = version
+                    , draft = Nothing
                     }
             in
             { model | retro = Retro.addContent columnId cardId content model.retro } ! []
@@ -186,6 +194,13 @@ socketUpdate user ( id, msgData ) model =
         Sock.Delete { columnId, cardId } ->
             { model | retro = Retro.removeCard columnId cardId model.retro } ! []
 
+        Sock.Conflict { columnId, cardId, contentId, cardText, version, draft } ->
+            { model
+                | input = draft
+                , retro = Retro.conflictContent columnId cardId contentId cardText version draft model.retro
+            }
+                ! []
+
         Sock.Error err ->
             Debug.log ("Sock.Error: " ++ toString err) model ! []
 
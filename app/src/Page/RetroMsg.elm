@@ -11,7 +11,7 @@ import Route exposing (Route)
 type Msg
     = ChangeInput Column.Id String
     | CreateCard Column.Id
-    | UpdateCard Column.Id Card.Id Content.Id
+    | UpdateCard Column.Id Card.Id Content.Id Int
     | DeleteCard Column.Id Card.Id
     | EditCard Column.Id Card.Id
     | SetStage Retro.Stage
@@ -11,3 +11,9 @@ port signOut : () -> Cmd msg
 
 
 port storageGot : (Maybe String -> msg) -> Sub msg
+
+
+port sockSend : String -> Cmd msg
+
+
+port sockReceive : (String -> msg) -> Sub msg
@@ -11,6 +11,7 @@ module Sock
         , listen
         , menu
         , move
+        , pong
         , reveal
         , send
         , stage
@@ -48,6 +49,8 @@ type MsgData
     | Delete DeleteData
     | User UserData
     | Retro RetroData
+    | Ping
+    | Conflict ConflictData
 
 
 type alias ErrorData =
@@ -60,6 +63,42 @@ errorDecoder =
         |> Pipeline.required "error" Decode.string
 
 
+{-| An edit was rejected because the content had changed, it has the current
+content along with the text that was rejected.
+-}
+type alias ConflictData =
+    { columnId : Column.Id
+    , cardId : Card.Id
+    , contentId : Content.Id
+    , cardText : String
+    , version : Int
+    , draft : String
+    }
+
+
+conflictDecoder : Decode.Decoder ConflictData
+conflictDecoder =
+    Pipeline.decode ConflictData
+        |> Pipeline.required "columnId" Column.decodeId
+        |> Pipeline.required "cardId" Card.decodeId
+        |> Pipeline.required "contentId" Content.decodeId
+        |> Pipeline.required "cardText" Decode.string
+        |> Pipeline.required "version" Decode.int
+        |> Pipeline.required "draft" Decode.string
+
+
+errorOrConflictDecoder : Decode.Decoder MsgData
+errorOrConflictDecoder =
+    Decode.field "error" Decode.string
+        |> Decode.andThen
+            (\error ->
+                if error == "conflict" then
+                    Decode.map Conflict conflictDecoder
+                else
+                    Decode.map Error errorDecoder
+            )
+
+
 type alias StageData =
     { stage : String }
 
@@ -109,6 +148,7 @@ type alias ContentData =
     , cardId : Card.Id
     , contentId : Content.Id
     , cardText : String
+    , version : Int
     }
 
 
@@ -119,6 +159,7 @@ contentDecoder =
         |> Pipeline.required "cardId" Card.decodeId
         |> Pipeline.required "contentId" Content.decodeId
         |> Pipeline.required "cardText" Decode.string
+        |> Pipeline.required "version" Decode.int
 
 
 type alias MoveData =
@@ -221,7 +262,7 @@ retroDecoder =
         |> Pipeline.required "participants" (Decode.list Decode.string)
 
 
-listen : String -> (String -> msg) -> Sub msg
+listen : (String -> msg) -> Sub msg
 listen =
     Sock.LowLevel.listen
 
@@ -230,7 +271,7 @@ update : String -> model -> (( String, MsgData ) -> model -> ( model, Cmd msg ))
 update data model f =
     let
         runOp decoder tagger d id m =
-            case Decode.decodeString decoder d of
+            case Decode.decodeValue decoder d of
                 Ok thing ->
                     f ( id, tagger thing ) m
 
@@ -248,10 +289,11 @@ update data model f =
                 , ( "group", runOp groupDecoder Group )
                 , ( "vote", runOp voteDecoder Vote )
                 , ( "unvote", runOp voteDecoder Unvote )
-                , ( "error", runOp errorDecoder Error )
+                , ( "error", runOp errorOrConflictDecoder identity )
                 , ( "delete", runOp deleteDecoder Delete )
                 , ( "user", runOp userDecoder User )
                 , ( "retro", runOp retroDecoder Retro )
+                , ( "ping", runOp (Decode.succeed Ping) identity )
                 ]
 
         runMux { id, op, data } model =
@@ -269,9 +311,9 @@ type alias Sender msg =
     String -> Encode.Value -> Cmd msg
 
 
-send : String -> String -> String -> Sender msg
-send url id token =
-    Sock.LowLevel.send url id token
+send : String -> String -> Sender msg
+send id token =
+    Sock.LowLevel.send id token
 
 
 joinRetro : Sender msg -> String -> Cmd msg
@@ -356,17 +398,23 @@ delete sender columnId cardId =
             ]
 
 
-edit : Sender msg -> Content.Id -> Column.Id -> Card.Id -> String -> Cmd msg
-edit sender contentId columnId cardId cardText =
+edit : Sender msg -> Content.Id -> Column.Id -> Card.Id -> String -> Int -> Cmd msg
+edit sender contentId columnId cardId cardText version =
     sender "edit" <|
         Encode.object
             [ ( "columnId", Column.encodeId columnId )
             , ( "contentId", Content.encodeId contentId )
             , ( "cardId", Card.encodeId cardId )
             , ( "cardText", Encode.string cardText )
+            , ( "version", Encode.int version )
             ]
 
 
+pong : Sender msg -> Cmd msg
+pong sender =
+    sender "pong" (Encode.object [])
+
+
 menu : Sender msg -> Cmd msg
 menu sender =
     sender "menu" <|
@@ -8,25 +8,29 @@ module Sock.LowLevel
 {-| This module provides a basic format for passing websocket messages with. It
 contains the generic parts of the implementation that define a JSON object with
 "id", "op" and "data" properties.
+
+It speaks version 2 of the protocol, where "data" is a JSON value rather than a
+string. The connection itself is made in index.js, through ports, so that it can
+fall back to Server-Sent Events when a websocket can't be opened.
 -}
 
 import Json.Decode as Decode
 import Json.Decode.Pipeline as Pipeline
 import Json.Encode as Encode
-import WebSocket
+import Port
 
 
 type alias SocketMsg =
     { id : String
     , op : String
-    , data : String
+    , data : Decode.Value
     }
 
 
 type alias AuthenticatedMsg =
     { id : String
     , op : String
-    , data : String
+    , data : Encode.Value
     , username : String
     , token : String
     }
@@ -37,7 +41,7 @@ socketMsgDecoder =
     Pipeline.decode SocketMsg
         |> Pipeline.required "id" Decode.string
         |> Pipeline.required "op" Decode.string
-        |> Pipeline.required "data" Decode.string
+        |> Pipeline.required "data" Decode.value
 
 
 socketMsgEncoder : SocketMsg -> Encode.Value
@@ -45,7 +49,7 @@ socketMsgEncoder value =
     Encode.object
         [ ( "id", Encode.string value.id )
         , ( "op", Encode.string value.op )
-        , ( "data", Encode.string value.data )
+        , ( "data", value.data )
         ]
 
 
@@ -60,21 +64,21 @@ authenticatedMsgEncoder value =
                 ]
           )
         , ( "op", Encode.string value.op )
-        , ( "data", Encode.string value.data )
+        , ( "data", value.data )
         ]
 
 
-send : String -> String -> String -> String -> Encode.Value -> Cmd msg
-send url id token op data =
-    AuthenticatedMsg id op (Encode.encode 0 data) id token
+send : String -> String -> String -> Encode.Value -> Cmd msg
+send id token op data =
+    AuthenticatedMsg id op data id token
         |> authenticatedMsgEncoder
         |> Encode.encode 0
-        |> WebSocket.send url
+        |> Port.sockSend
 
 
-listen : String -> (String -> msg) -> Sub msg
-listen url tagger =
-    WebSocket.listen url tagger
+listen : (String -> msg) -> Sub msg
+listen tagger =
+    Port.sockReceive tagger
 
 
 update : String -> model -> (SocketMsg -> model -> ( model, Cmd msg )) -> ( model, Cmd msg )
@@ -21,11 +21,25 @@ view columnId card =
 
 editContentView : Column.Id -> Card.Id -> Content -> Html Msg
 editContentView columnId cardId content =
-    Bulma.content []
-        [ Html.p [ Attr.class "title is-6" ] [ Html.text content.author ]
-        , Html.textarea
-            [ Event.onInput (ChangeInput columnId)
-            , ExtraEvent.onEnter (UpdateCard columnId cardId content.id)
-            ]
-            [ Html.text content.text ]
-        ]
+    let
+        textarea text =
+            Html.textarea
+                [ Event.onInput (ChangeInput columnId)
+                , ExtraEvent.onEnter (UpdateCard columnId cardId content.id content.version)
+                ]
+                [ Html.text text ]
+    in
+    case content.draft of
+        Just draft ->
+            Bulma.content []
+                [ Html.p [ Attr.class "title is-6" ] [ Html.text content.author ]
+                , Html.p [] [ Html.text "This was changed while you were editing it, it now reads:" ]
+                , Html.blockquote [] [ Html.text content.text ]
+                , textarea draft
+                ]
+
+        Nothing ->
+            Bulma.content []
+                [ Html.p [ Attr.class "title is-6" ] [ Html.text content.author ]
+                , textarea content.text
+                ]
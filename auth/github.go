@@ -4,12 +4,13 @@ import (
 	"context"
 	"golang.org/x/oauth2"
 	"net/http"
-	"log"
+	"log/slog"
 	"encoding/json"
+	"errors"
 	"github.com/google/uuid"
 )
 
-func GitHub(addUser func(user, token string), clientID, clientSecret, organisation string) (login, callback http.HandlerFunc) {
+func GitHub(addUser func(user, email, token string), clientID, clientSecret, organisation string) (login, callback http.HandlerFunc) {
 	ctx := context.Background()
 	conf := &oauth2.Config{
 		ClientID:     clientID,
@@ -32,30 +33,31 @@ func GitHub(addUser func(user, token string), clientID, clientSecret, organisati
 
 		tok, err := conf.Exchange(ctx, code)
 		if err != nil {
-			log.Println(err)
+			slog.Error("exchange code", "provider", "github", "err", err)
 			return
 		}
 
 		client := conf.Client(ctx, tok)
 
-		user, err := getUser(client)
+		user, email, err := getUser(client)
 		if err != nil {
-			log.Println(err)
+			slog.Error("get user", "provider", "github", "err", err)
 			return
 		}
 
 		inOrg, err := isInOrg(client, organisation)
 		if err != nil {
-			log.Println(err)
+			slog.Error("check organisation", "provider", "github", "err", err)
 			return
 		}
 
 		if inOrg {
 			token := strId()
-			addUser(user, token)
+			addUser(user, email, token)
 
 			http.Redirect(w, r, "/?user="+user+"&token="+token, http.StatusFound)
 		} else {
+			slog.Warn("not in organisation", "provider", "github", "username", user)
 			http.Redirect(w, r, "/?error=not_in_org", http.StatusFound)
 		}
 	}
@@ -63,21 +65,58 @@ func GitHub(addUser func(user, token string), clientID, clientSecret, organisati
 	return login, callback
 }
 
-func getUser(client *http.Client) (string, error) {
+func getUser(client *http.Client) (string, string, error) {
 	resp, err := client.Get("https://api.github.com/user")
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 	defer resp.Body.Close()
 
 	var data struct {
 		Login string `json:"login"`
+		Email string `json:"email"`
 	}
 	if err = json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return "", "", err
+	}
+
+	if data.Email == "" {
+		// The email is only used for sending mail, so signing in can continue
+		// without it.
+		if data.Email, err = getPrimaryEmail(client); err != nil {
+			slog.Warn("get primary email", "provider", "github", "username", data.Login, "err", err)
+		}
+	}
+
+	return data.Login, data.Email, nil
+}
+
+func getPrimaryEmail(client *http.Client) (string, error) {
+	resp, err := client.Get("https://api.github.com/user/emails")
+	if err != nil {
 		return "", err
 	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.New("github: get /user/emails returned " + resp.Status)
+	}
+
+	var data []struct {
+		Email   string `json:"email"`
+		Primary bool   `json:"primary"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return "", err
+	}
+
+	for _, email := range data {
+		if email.Primary {
+			return email.Email, nil
+		}
+	}
 
-	return data.Login, nil
+	return "", nil
 }
 
 func isInOrg(client *http.Client, expectedOrg string) (bool, error) {
@@ -5,11 +5,11 @@ import (
 	"strings"
 	"encoding/json"
 	"golang.org/x/oauth2"
-	"log"
+	"log/slog"
 	"net/http"
 )
 
-func Office365(addUser func(user, token string), clientID, clientSecret, domain string) (login, callback http.HandlerFunc) {
+func Office365(addUser func(user, email, token string), clientID, clientSecret, domain string) (login, callback http.HandlerFunc) {
 	ctx := context.Background()
 	conf := &oauth2.Config{
 		ClientID:     clientID,
@@ -32,7 +32,7 @@ func Office365(addUser func(user, token string), clientID, clientSecret, domain
 
 		tok, err := conf.Exchange(ctx, code)
 		if err != nil {
-			log.Println(err)
+			slog.Error("exchange code", "provider", "office365", "err", err)
 			return
 		}
 
@@ -40,16 +40,17 @@ func Office365(addUser func(user, token string), clientID, clientSecret, domain
 
 		user, err := getOfficeUser(client)
 		if err != nil {
-			log.Println(err)
+			slog.Error("get user", "provider", "office365", "err", err)
 			return
 		}
 
 		if isInDomain(user, domain) {
 			token := strId()
-			addUser(user, token)
+			addUser(user, user, token)
 
 			http.Redirect(w, r, "/?user="+user+"&token="+token, http.StatusFound)
 		} else {
+			slog.Warn("not in domain", "provider", "office365", "username", user)
 			http.Redirect(w, r, "/?error=not_in_org", http.StatusFound)
 		}
 	}
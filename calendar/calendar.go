@@ -0,0 +1,97 @@
+// Package calendar writes iCalendar (RFC 5545) feeds, so that scheduled retros
+// can be subscribed to from calendar apps.
+package calendar
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+)
+
+type Event struct {
+	// UID must be unique and stay the same for the event across requests.
+	UID     string
+	Summary string
+	Start   time.Time
+	End     time.Time
+	URL     string
+}
+
+// Write writes a calendar called name containing the events to w.
+func Write(w io.Writer, name string, events []Event) error {
+	cw := &writer{w: bufio.NewWriter(w)}
+	now := time.Now()
+
+	cw.line("BEGIN:VCALENDAR")
+	cw.line("VERSION:2.0")
+	cw.line("PRODID:-//hawx.me//retro//EN")
+	cw.line("CALSCALE:GREGORIAN")
+	cw.line("X-WR-CALNAME:" + escape(name))
+
+	for _, event := range events {
+		cw.line("BEGIN:VEVENT")
+		cw.line("UID:" + escape(event.UID))
+		cw.line("DTSTAMP:" + formatTime(now))
+		cw.line("DTSTART:" + formatTime(event.Start))
+		cw.line("DTEND:" + formatTime(event.End))
+		cw.line("SUMMARY:" + escape(event.Summary))
+		if event.URL != "" {
+			cw.line("URL:" + event.URL)
+		}
+		cw.line("END:VEVENT")
+	}
+
+	cw.line("END:VCALENDAR")
+
+	if cw.err != nil {
+		return cw.err
+	}
+	return cw.w.Flush()
+}
+
+type writer struct {
+	w   *bufio.Writer
+	err error
+}
+
+// line writes s followed by CRLF, folding it so that no line is longer than 75
+// octets.
+func (w *writer) line(s string) {
+	if w.err != nil {
+		return
+	}
+
+	// continuation lines start with a space, which counts towards the limit
+	limit := 75
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !isRuneStart(s[cut]) {
+			cut--
+		}
+
+		if _, w.err = w.w.WriteString(s[:cut] + "\r\n "); w.err != nil {
+			return
+		}
+		s = s[cut:]
+		limit = 74
+	}
+
+	_, w.err = w.w.WriteString(s + "\r\n")
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// Line breaks, in any form, become an escaped newline so that text can't start
+// a new property.
+var escaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
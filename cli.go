@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"hawx.me/code/retro/database"
+)
+
+const commandUsage = `Usage: retro [options] [command]
+
+With no command the server is started. The commands operate directly on the
+database given by --db:
+
+  users list             list all users
+  users revoke NAME      sign out a user by revoking their token
+  users export NAME      write everything stored about a user as JSON
+  users erase NAME       delete a user, replacing them with a pseudonym
+  retros list            list all retros
+  retros delete ID       delete a retro and everything in it
+  backup PATH            write a copy of the database to PATH, or if PATH is a
+                         directory a timestamped snapshot into it
+  restore PATH           check the backup at PATH then replace the database
+                         with it, the server must not be running
+  migrate                apply any outstanding migrations
+  purge [--dry-run]      archive and delete retros past their retention
+                         period, or with --dry-run list what would be done
+  audit                  list the most recent audit log entries
+  rotate-key [--decrypt] re-encrypt all text with the key in RETRO_NEW_KEY, or
+                         with --decrypt store it as plaintext, the server must
+                         not be running
+
+Options:
+`
+
+var errUsage = errors.New("unknown command, see --help")
+
+// runCommand carries out an admin command against the database at dbPath.
+func runCommand(dbPath string, conf config, args []string) error {
+	if len(args) == 2 && args[0] == "restore" {
+		return restore(dbPath, args[1])
+	}
+
+	db, err := openDatabase(dbPath, conf)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "users":
+		switch {
+		case len(args) == 2 && args[1] == "list":
+			return listUsers(db, os.Stdout)
+		case len(args) == 3 && args[1] == "revoke":
+			return db.RevokeUser(args[2])
+		case len(args) == 3 && args[1] == "export":
+			return exportUser(db, args[2], os.Stdout)
+		case len(args) == 3 && args[1] == "erase":
+			pseudonym, err := db.EraseUser(args[2])
+			if err != nil {
+				return err
+			}
+			fmt.Println("erased, now known as", pseudonym)
+			return nil
+		}
+
+	case "retros":
+		switch {
+		case len(args) == 2 && args[1] == "list":
+			return listRetros(db, os.Stdout)
+		case len(args) == 3 && args[1] == "delete":
+			return db.DeleteRetro(args[2])
+		}
+
+	case "backup":
+		if len(args) == 2 {
+			return backup(db, args[1])
+		}
+
+	case "migrate":
+		version, err := db.Version()
+		if err != nil {
+			return err
+		}
+		fmt.Println("database is at version", version)
+		return nil
+
+	case "purge":
+		set := flag.NewFlagSet("purge", flag.ContinueOnError)
+		dryRun := set.Bool("dry-run", false, "")
+		if err := set.Parse(args[1:]); err != nil || set.NArg() > 0 {
+			return errUsage
+		}
+
+		now := time.Now()
+		steps, err := planPurge(db, conf.Retention, now)
+		if err != nil {
+			return err
+		}
+
+		writePurgeReport(os.Stdout, steps)
+		if *dryRun {
+			return nil
+		}
+		return purge(db, steps, now)
+
+	case "audit":
+		if len(args) == 1 {
+			return listAudit(db, os.Stdout)
+		}
+
+	case "rotate-key":
+		set := flag.NewFlagSet("rotate-key", flag.ContinueOnError)
+		decrypt := set.Bool("decrypt", false, "")
+		if err := set.Parse(args[1:]); err != nil || set.NArg() > 0 {
+			return errUsage
+		}
+
+		var newKey []byte
+		if !*decrypt {
+			newKey, err = base64.StdEncoding.DecodeString(os.Getenv("RETRO_NEW_KEY"))
+			if err != nil {
+				return err
+			}
+			if len(newKey) == 0 {
+				return errors.New("RETRO_NEW_KEY must be set, or pass --decrypt")
+			}
+		}
+
+		if err := db.RotateKey(newKey); err != nil {
+			return err
+		}
+
+		if *decrypt {
+			fmt.Println("decrypted all text, remove the key before starting the server")
+		} else {
+			fmt.Println("re-encrypted all text, set RETRO_KEY to the new key before starting the server")
+		}
+		return nil
+	}
+
+	return errUsage
+}
+
+func listUsers(db *database.Database, w io.Writer) error {
+	users, err := db.GetUsers()
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "USERNAME\tEMAIL\tSIGNED IN")
+	for _, user := range users {
+		fmt.Fprintf(tw, "%s\t%s\t%t\n", user.Username, user.Email, user.Token != "")
+	}
+
+	return tw.Flush()
+}
+
+func listAudit(db *database.Database, w io.Writer) error {
+	audits, err := db.GetAudit(100)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "AT\tACTOR\tACTION\tSUBJECT\tDETAIL")
+	for _, audit := range audits {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", audit.At.Format("2006-01-02 15:04"), audit.Actor, audit.Action, audit.Subject, audit.Detail)
+	}
+
+	return tw.Flush()
+}
+
+func exportUser(db *database.Database, username string, w io.Writer) error {
+	export, err := db.ExportUser(username)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(export); err != nil {
+		return err
+	}
+
+	return db.AddAudit(database.Audit{
+		At:      time.Now(),
+		Actor:   "admin",
+		Action:  "export",
+		Subject: username,
+	})
+}
+
+func listRetros(db *database.Database, w io.Writer) error {
+	retros, err := db.GetAllRetros()
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tSTAGE\tCREATED\tPARTICIPANTS")
+	for _, retro := range retros {
+		participants, err := db.GetParticipants(retro.Id)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", retro.Id, retro.Name, retro.Stage, retro.CreatedAt.Format("2006-01-02 15:04"), strings.Join(participants, ","))
+	}
+
+	return tw.Flush()
+}
+
+func backup(db *database.Database, path string) error {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		path, err = db.Snapshot(path, 0)
+		if err != nil {
+			return err
+		}
+	} else if err = db.Backup(path); err != nil {
+		return err
+	}
+
+	fmt.Println("wrote", path)
+	return nil
+}
+
+// restore replaces the database at dbPath with the file at backupPath, once it
+// has passed an integrity check. The copy is written alongside dbPath first so
+// the database is never left half written.
+func restore(dbPath, backupPath string) error {
+	if err := database.CheckIntegrity(backupPath); err != nil {
+		return err
+	}
+
+	src, err := os.Open(backupPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.CreateTemp(filepath.Dir(dbPath), ".restore-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(dst.Name())
+
+	if _, err = io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err = dst.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(dst.Name(), dbPath)
+}
@@ -0,0 +1,114 @@
+package database
+
+import "time"
+
+// Action is something agreed in a retro that needs to be done afterwards. It
+// may be linked to an issue in an external tracker, in which case IssueKey and
+// IssueURL are set. IssuePending is set when creating the issue failed, so that
+// it can be retried.
+type Action struct {
+	Id       string
+	Retro    string
+	Text     string
+	Owner    string
+	DueAt    time.Time
+	Closed   bool
+	IssueKey string
+	IssueURL string
+
+	IssuePending bool
+}
+
+func (d *Database) AddAction(action Action) error {
+	text, err := seal(d.aead, action.Id, action.Text)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.exec("INSERT INTO actions(Id, Retro, Text, Owner, DueAt, Closed, IssueKey, IssueURL, IssuePending) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		action.Id,
+		action.Retro,
+		text,
+		action.Owner,
+		action.DueAt,
+		action.Closed,
+		action.IssueKey,
+		action.IssueURL,
+		action.IssuePending)
+
+	return err
+}
+
+// LinkAction records the issue created for the action.
+func (d *Database) LinkAction(id, issueKey, issueURL string) error {
+	_, err := d.exec("UPDATE actions SET IssueKey=?, IssueURL=?, IssuePending=0 WHERE Id=?",
+		issueKey,
+		issueURL,
+		id)
+
+	return err
+}
+
+func (d *Database) SetActionClosed(id string, closed bool) error {
+	_, err := d.exec("UPDATE actions SET Closed=? WHERE Id=?",
+		closed,
+		id)
+
+	return err
+}
+
+func (d *Database) GetActions(retroId string) (actions []Action, err error) {
+	return d.queryActions("SELECT Id, Retro, Text, Owner, DueAt, Closed, IssueKey, IssueURL, IssuePending FROM actions WHERE Retro=?",
+		retroId)
+}
+
+// GetLinkedActions returns all actions that are linked to an issue, so that
+// their status can be kept in sync with the tracker.
+func (d *Database) GetLinkedActions() (actions []Action, err error) {
+	return d.queryActions("SELECT Id, Retro, Text, Owner, DueAt, Closed, IssueKey, IssueURL, IssuePending FROM actions WHERE IssueKey <> ''")
+}
+
+// GetPendingActions returns all open actions whose issue could not be created,
+// so that it can be tried again.
+func (d *Database) GetPendingActions() (actions []Action, err error) {
+	return d.queryActions("SELECT Id, Retro, Text, Owner, DueAt, Closed, IssueKey, IssueURL, IssuePending FROM actions WHERE IssuePending = 1 AND Closed = 0")
+}
+
+// GetActionsDueBefore returns the open actions with an owner that are due
+// before t and have not yet had a reminder sent.
+func (d *Database) GetActionsDueBefore(t time.Time) (actions []Action, err error) {
+	return d.queryActions(`
+    SELECT Id, Retro, Text, Owner, DueAt, Closed, IssueKey, IssueURL, IssuePending
+    FROM actions
+    WHERE Closed = 0 AND Owner <> '' AND DueAt > ? AND DueAt < ? AND RemindedAt IS NULL`,
+		time.Time{}, t)
+}
+
+func (d *Database) SetActionReminded(id string, at time.Time) error {
+	_, err := d.exec("UPDATE actions SET RemindedAt=? WHERE Id=?",
+		at,
+		id)
+
+	return err
+}
+
+func (d *Database) queryActions(query string, args ...interface{}) (actions []Action, err error) {
+	rows, err := d.query(query, args...)
+	if err != nil {
+		return actions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var action Action
+		if err = rows.Scan(&action.Id, &action.Retro, &action.Text, &action.Owner, &action.DueAt, &action.Closed, &action.IssueKey, &action.IssueURL, &action.IssuePending); err != nil {
+			return actions, err
+		}
+		if action.Text, err = open(d.aead, action.Id, action.Text); err != nil {
+			return actions, err
+		}
+		actions = append(actions, action)
+	}
+
+	return actions, rows.Err()
+}
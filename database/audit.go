@@ -0,0 +1,44 @@
+package database
+
+import "time"
+
+// Audit records an administrative change to the data, such as retros being
+// removed by the retention policy.
+type Audit struct {
+	At      time.Time
+	Actor   string
+	Action  string
+	Subject string
+	Detail  string
+}
+
+func (d *Database) AddAudit(audit Audit) error {
+	_, err := d.exec("INSERT INTO audit(At, Actor, Action, Subject, Detail) VALUES (?, ?, ?, ?, ?)",
+		audit.At,
+		audit.Actor,
+		audit.Action,
+		audit.Subject,
+		audit.Detail)
+
+	return err
+}
+
+// GetAudit returns the most recent limit entries, newest first.
+func (d *Database) GetAudit(limit int) (audits []Audit, err error) {
+	rows, err := d.query("SELECT At, Actor, Action, Subject, Detail FROM audit ORDER BY Id DESC LIMIT ?",
+		limit)
+	if err != nil {
+		return audits, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var audit Audit
+		if err = rows.Scan(&audit.At, &audit.Actor, &audit.Action, &audit.Subject, &audit.Detail); err != nil {
+			return audits, err
+		}
+		audits = append(audits, audit)
+	}
+
+	return audits, rows.Err()
+}
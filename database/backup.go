@@ -0,0 +1,170 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mxk/go-sqlite/sqlite3"
+)
+
+// backuper is implemented by the driver's connections. The bundled SQLite is
+// too old for VACUUM INTO, so backups use its online backup API instead.
+type backuper interface {
+	Backup(srcName string, dst *sqlite3.Conn, dstName string) (*sqlite3.Backup, error)
+}
+
+// Backup writes a consistent copy of the database to path, which must not
+// already exist. It can be used while the database is being written to.
+func (d *Database) Backup(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return errors.New("backup: " + path + " already exists")
+	}
+
+	dst, err := sqlite3.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	conn, err := d.db.Conn(d.context())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn interface{}) error {
+		src, ok := driverConn.(backuper)
+		if !ok {
+			return errors.New("backup: driver does not support backups")
+		}
+
+		b, err := src.Backup("main", dst, "main")
+		if err != nil {
+			return err
+		}
+
+		// Step returns nil until every page has been copied.
+		for err == nil {
+			err = b.Step(-1)
+		}
+		if err != io.EOF {
+			b.Close()
+			return err
+		}
+
+		return b.Close()
+	})
+}
+
+const (
+	snapshotPrefix = "retro-"
+	snapshotSuffix = ".db"
+	snapshotFormat = "20060102T150405Z"
+)
+
+// Snapshot writes a backup into dir named with the current time, then removes
+// the oldest snapshots so that at most keep remain. If keep is zero no
+// snapshots are removed.
+func (d *Database) Snapshot(dir string, keep int) (string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, snapshotPrefix+time.Now().UTC().Format(snapshotFormat)+snapshotSuffix)
+	if err := d.Backup(path); err != nil {
+		return "", err
+	}
+
+	if keep <= 0 {
+		return path, nil
+	}
+
+	snapshots, err := Snapshots(dir)
+	if err != nil {
+		return path, err
+	}
+
+	for len(snapshots) > keep {
+		if err := os.Remove(snapshots[0]); err != nil {
+			return path, err
+		}
+		snapshots = snapshots[1:]
+	}
+
+	return path, nil
+}
+
+// Snapshots lists the snapshots in dir, oldest first.
+func Snapshots(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.Type().IsRegular() && strings.HasPrefix(name, snapshotPrefix) && strings.HasSuffix(name, snapshotSuffix) {
+			snapshots = append(snapshots, filepath.Join(dir, name))
+		}
+	}
+
+	// the timestamp format sorts lexically
+	sort.Strings(snapshots)
+
+	return snapshots, nil
+}
+
+// CheckIntegrity opens the database file at path and returns an error if
+// SQLite finds any problems with it, or it was written by a newer version.
+func CheckIntegrity(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("PRAGMA integrity_check")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var result string
+		if err = rows.Scan(&result); err != nil {
+			return err
+		}
+		if result != "ok" {
+			problems = append(problems, result)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	if len(problems) > 0 {
+		return errors.New("integrity check failed: " + strings.Join(problems, "; "))
+	}
+
+	var version int
+	if err = db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	if version > len(migrations) {
+		return errors.New("backup is from a newer version of retro")
+	}
+
+	return nil
+}
@@ -9,7 +9,7 @@ type Card struct {
 }
 
 func (d *Database) AddCard(card Card) error {
-	_, err := d.db.Exec("INSERT INTO cards(Id, Column, Revealed) VALUES (?, ?, ?)",
+	_, err := d.exec("INSERT INTO cards(Id, Column, Revealed) VALUES (?, ?, ?)",
 		card.Id,
 		card.Column,
 		card.Revealed)
@@ -18,7 +18,7 @@ func (d *Database) AddCard(card Card) error {
 }
 
 func (d *Database) MoveCard(id, columnId string) error {
-	_, err := d.db.Exec("UPDATE cards SET Column=? WHERE Id=?",
+	_, err := d.exec("UPDATE cards SET Column=? WHERE Id=?",
 		columnId,
 		id)
 
@@ -26,21 +26,35 @@ func (d *Database) MoveCard(id, columnId string) error {
 }
 
 func (d *Database) RevealCard(id string) error {
-	_, err := d.db.Exec("UPDATE cards SET Revealed=1 WHERE Id=?",
+	_, err := d.exec("UPDATE cards SET Revealed=1 WHERE Id=?",
 		id)
 
 	return err
 }
 
+// DeleteCard removes the card along with its contents and votes.
 func (d *Database) DeleteCard(id string) error {
-	_, err := d.db.Exec("DELETE FROM cards WHERE Id=?",
-		id)
+	tx, err := d.begin()
+	if err != nil {
+		return err
+	}
 
-	return err
+	for _, query := range []string{
+		"DELETE FROM votes WHERE Card=?",
+		"DELETE FROM contents WHERE Card=?",
+		"DELETE FROM cards WHERE Id=?",
+	} {
+		if _, err = tx.Exec(query, id); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
 }
 
 func (d *Database) GroupCards(cardFrom, cardTo string) error {
-	tx, err := d.db.Begin()
+	tx, err := d.begin()
 	if err != nil {
 		return err
 	}
@@ -75,7 +89,7 @@ func (d *Database) GroupCards(cardFrom, cardTo string) error {
 }
 
 func (d *Database) GetCards(username, columnId string) (cards []Card, err error) {
-	rows, err := d.db.Query(`
+	rows, err := d.query(`
     SELECT cards.Id,
            cards.Column,
            cards.Revealed,
@@ -101,3 +115,12 @@ func (d *Database) GetCards(username, columnId string) (cards []Card, err error)
 
 	return cards, rows.Err()
 }
+
+// GetCardRetro returns the id of the retro that the card is in.
+func (d *Database) GetCardRetro(id string) (retroId string, err error) {
+	row := d.queryRow("SELECT columns.Retro FROM cards INNER JOIN columns ON cards.Column = columns.Id WHERE cards.Id=?",
+		id)
+
+	err = row.Scan(&retroId)
+	return
+}
@@ -7,18 +7,8 @@ type Column struct {
 	Order int
 }
 
-func (d *Database) AddColumn(column Column) error {
-	_, err := d.db.Exec("INSERT INTO columns(Id, Retro, Name, \"Order\") VALUES (?, ?, ?, ?)",
-		column.Id,
-		column.Retro,
-		column.Name,
-		column.Order)
-
-	return err
-}
-
 func (d *Database) GetColumn(id string) (Column, error) {
-	row := d.db.QueryRow("SELECT Id, Retro, Name, Order FROM columns WHERE Id=?",
+	row := d.queryRow("SELECT Id, Retro, Name, \"Order\" FROM columns WHERE Id=?",
 		id)
 
 	var column Column
@@ -28,7 +18,7 @@ func (d *Database) GetColumn(id string) (Column, error) {
 }
 
 func (d *Database) GetColumns(retroId string) (columns []Column, err error) {
-	rows, err := d.db.Query("SELECT Id, Retro, Name, \"Order\" FROM columns WHERE Retro=? ORDER BY \"Order\"",
+	rows, err := d.query("SELECT Id, Retro, Name, \"Order\" FROM columns WHERE Retro=? ORDER BY \"Order\"",
 		retroId)
 	if err != nil {
 		return columns, err
@@ -1,42 +1,118 @@
 package database
 
+import (
+	"database/sql"
+	"errors"
+)
+
+// ErrConflict is returned by UpdateContent when the content has been changed
+// since the version the update was based on.
+var ErrConflict = errors.New("content has been changed")
+
 type Content struct {
 	Id     string
 	Card   string
 	Text   string
 	Author string
+
+	// Version starts at 1 and is incremented each time Text is updated.
+	Version int
 }
 
 func (d *Database) AddContent(content Content) error {
-	_, err := d.db.Exec("INSERT INTO contents(Id, Card, Text, Author) VALUES (?, ?, ?, ?)",
+	text, err := seal(d.aead, content.Id, content.Text)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.exec("INSERT INTO contents(Id, Card, Text, Author, Version) VALUES (?, ?, ?, ?, 1)",
 		content.Id,
 		content.Card,
-		content.Text,
+		text,
 		content.Author)
 
 	return err
 }
 
-func (d *Database) UpdateContent(id string, text string) error { 
-	_, err := d.db.Exec("UPDATE contents SET Text=? WHERE Id=?",
+// UpdateContent sets the text of the content, as long as it is still at
+// version. It returns the new version, or ErrConflict if the content has been
+// updated since. If version is 0, for clients that don't track versions, the
+// text is set whatever the current version.
+func (d *Database) UpdateContent(id string, text string, version int) (int, error) {
+	text, err := seal(d.aead, id, text)
+	if err != nil {
+		return 0, err
+	}
+
+	if version == 0 {
+		return d.overwriteContent(id, text)
+	}
+
+	res, err := d.exec("UPDATE contents SET Text=?, Version=Version+1 WHERE Id=? AND Version=?",
+		text,
+		id,
+		version)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = expectRows(res); err == sql.ErrNoRows {
+		// Either it doesn't exist, or it is at a different version.
+		row := d.queryRow("SELECT 1 FROM contents WHERE Id=?", id)
+		var exists int
+		if err = row.Scan(&exists); err == nil {
+			err = ErrConflict
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return version + 1, nil
+}
+
+// overwriteContent sets the already sealed text of the content, returning its
+// new version.
+func (d *Database) overwriteContent(id string, text string) (version int, err error) {
+	tx, err := d.begin()
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := tx.Exec("UPDATE contents SET Text=?, Version=Version+1 WHERE Id=?",
 		text,
 		id)
+	if err == nil {
+		err = expectRows(res)
+	}
+	if err == nil {
+		err = tx.QueryRow("SELECT Version FROM contents WHERE Id=?", id).Scan(&version)
+	}
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
 
-	return err	
+	return version, tx.Commit()
 }
 
 func (d *Database) GetContent(id string) (Content, error) {
-	row := d.db.QueryRow("SELECT Id, Card, Text, Author FROM contents WHERE Id=?",
+	row := d.queryRow("SELECT Id, Card, Text, Author, Version FROM contents WHERE Id=?",
 		id)
 
 	var content Content
-	err := row.Scan(&content.Id, &content.Card, &content.Text, &content.Author)
+	if err := row.Scan(&content.Id, &content.Card, &content.Text, &content.Author, &content.Version); err != nil {
+		return content, err
+	}
+
+	var err error
+	content.Text, err = open(d.aead, content.Id, content.Text)
 
 	return content, err
 }
 
 func (d *Database) GetContents(cardId string) (contents []Content, err error) {
-	rows, err := d.db.Query("SELECT Id, Card, Text, Author FROM contents WHERE Card=?",
+	rows, err := d.query("SELECT Id, Card, Text, Author, Version FROM contents WHERE Card=?",
 		cardId)
 	if err != nil {
 		return contents, err
@@ -45,7 +121,10 @@ func (d *Database) GetContents(cardId string) (contents []Content, err error) {
 
 	for rows.Next() {
 		var content Content
-		if err = rows.Scan(&content.Id, &content.Card, &content.Text, &content.Author); err != nil {
+		if err = rows.Scan(&content.Id, &content.Card, &content.Text, &content.Author, &content.Version); err != nil {
+			return contents, err
+		}
+		if content.Text, err = open(d.aead, content.Id, content.Text); err != nil {
 			return contents, err
 		}
 		contents = append(contents, content)
@@ -53,3 +132,12 @@ func (d *Database) GetContents(cardId string) (contents []Content, err error) {
 
 	return contents, rows.Err()
 }
+
+// GetContentRetro returns the id of the retro that the content is in.
+func (d *Database) GetContentRetro(id string) (retroId string, err error) {
+	row := d.queryRow("SELECT columns.Retro FROM contents INNER JOIN cards ON contents.Card = cards.Id INNER JOIN columns ON cards.Column = columns.Id WHERE contents.Id=?",
+		id)
+
+	err = row.Scan(&retroId)
+	return
+}
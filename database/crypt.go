@@ -0,0 +1,160 @@
+package database
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// sealedPrefix marks text that has been encrypted, so that text written before
+// a key was set can still be read. Plaintext that happens to start with
+// encodedPrefix is stored after plainPrefix, so that it isn't mistaken for
+// sealed text.
+const (
+	encodedPrefix = "enc:"
+	sealedPrefix  = encodedPrefix + "v1:"
+	plainPrefix   = encodedPrefix + "plain:"
+)
+
+var ErrNoKey = errors.New("database: text is encrypted but no key is set")
+
+// SetKey sets the key used to encrypt the text of contents and actions. The
+// key must be 32 bytes long for AES-256-GCM. If key is nil text is stored as
+// plaintext.
+func (d *Database) SetKey(key []byte) error {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+
+	d.aead = aead
+	return nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if key == nil {
+		return nil, nil
+	}
+
+	if len(key) != 32 {
+		return nil, errors.New("database: key must be 32 bytes")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts text for the row with the given id. The id is authenticated
+// along with the text so that values can't be swapped between rows.
+func seal(aead cipher.AEAD, id, text string) (string, error) {
+	if aead == nil {
+		if strings.HasPrefix(text, encodedPrefix) {
+			return plainPrefix + text, nil
+		}
+		return text, nil
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(text), []byte(id))
+
+	return sealedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// open reverses seal, text that was not sealed is returned as is.
+func open(aead cipher.AEAD, id, stored string) (string, error) {
+	if strings.HasPrefix(stored, plainPrefix) {
+		return stored[len(plainPrefix):], nil
+	}
+	if !strings.HasPrefix(stored, sealedPrefix) {
+		return stored, nil
+	}
+	if aead == nil {
+		return "", ErrNoKey
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(stored[len(sealedPrefix):])
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("database: sealed text too short")
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	text, err := aead.Open(nil, nonce, ciphertext, []byte(id))
+
+	return string(text), err
+}
+
+// RotateKey re-encrypts the text of every content and action with newKey, and
+// starts using it. If newKey is nil all text is decrypted. Nothing else may be
+// writing to the database, as it would still be using the old key.
+func (d *Database) RotateKey(newKey []byte) error {
+	newAead, err := newAEAD(newKey)
+	if err != nil {
+		return err
+	}
+
+	tx, err := d.begin()
+	if err != nil {
+		return err
+	}
+
+	for _, table := range []string{"contents", "actions"} {
+		rows, err := tx.Query("SELECT Id, Text FROM " + table)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		texts := map[string]string{}
+		for rows.Next() {
+			var id, stored string
+			if err = rows.Scan(&id, &stored); err != nil {
+				break
+			}
+			if texts[id], err = open(d.aead, id, stored); err != nil {
+				break
+			}
+		}
+		rows.Close()
+		if err == nil {
+			err = rows.Err()
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		for id, text := range texts {
+			sealed, err := seal(newAead, id, text)
+			if err != nil {
+				tx.Rollback()
+				return err
+			}
+
+			if _, err = tx.Exec("UPDATE "+table+" SET Text=? WHERE Id=?", sealed, id); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	d.aead = newAead
+	return nil
+}
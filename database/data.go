@@ -3,11 +3,20 @@ package database
 import (
 	_ "github.com/mxk/go-sqlite/sqlite3"
 
+	"context"
+	"crypto/cipher"
 	"database/sql"
+	"fmt"
 )
 
 type Database struct {
 	db *sql.DB
+
+	// aead encrypts text when a key has been set.
+	aead cipher.AEAD
+
+	// ctx is used for statements, see WithContext.
+	ctx context.Context
 }
 
 func Open(path string) (*Database, error) {
@@ -16,13 +25,17 @@ func Open(path string) (*Database, error) {
 		return nil, err
 	}
 
-	db := &Database{sqlite}
+	db := &Database{db: sqlite}
+
+	if err := db.setup(); err != nil {
+		return db, err
+	}
 
-	return db, db.setup()
+	return db, db.migrate()
 }
 
 func (d *Database) setup() error {
-	_, err := d.db.Exec(`
+	_, err := d.exec(`
     CREATE TABLE IF NOT EXISTS users (
       Username  TEXT PRIMARY KEY,
       Token     TEXT
@@ -74,11 +87,112 @@ func (d *Database) setup() error {
       FOREIGN KEY(Username) REFERENCES users(Username),
       FOREIGN KEY(Card) REFERENCES cards(Id)
     );
+
+    CREATE TABLE IF NOT EXISTS actions (
+      Id        TEXT PRIMARY KEY,
+      Retro     TEXT,
+      Text      TEXT,
+      Owner     TEXT,
+      DueAt     DATETIME,
+      Closed    BOOLEAN,
+      IssueKey  TEXT,
+      IssueURL  TEXT,
+      FOREIGN KEY(Retro) REFERENCES retros(Id)
+    );
   `)
 
 	return err
 }
 
+// migrations are applied in order to bring the tables created by setup up to
+// date. The number applied is recorded in the user_version pragma, so new
+// migrations must only ever be added to the end of the list.
+var migrations = []string{
+	`ALTER TABLE users ADD COLUMN Email TEXT DEFAULT ''`,
+	`ALTER TABLE actions ADD COLUMN RemindedAt DATETIME`,
+	`CREATE TABLE teams (
+      Id         TEXT PRIMARY KEY,
+      Name       TEXT,
+      Columns    TEXT,
+      EveryWeeks INTEGER,
+      NextAt     DATETIME,
+      Length     INTEGER
+    )`,
+	`CREATE TABLE members (
+      Team       TEXT,
+      Username   TEXT,
+      PRIMARY KEY(Team, Username),
+      FOREIGN KEY(Team) REFERENCES teams(Id),
+      FOREIGN KEY(Username) REFERENCES users(Username)
+    )`,
+	`ALTER TABLE retros ADD COLUMN Team TEXT DEFAULT ''`,
+	`ALTER TABLE retros ADD COLUMN ScheduledAt DATETIME`,
+	`ALTER TABLE retros ADD COLUMN ArchivedAt DATETIME`,
+	`ALTER TABLE teams ADD COLUMN RetentionDays INTEGER DEFAULT 0`,
+	`CREATE TABLE audit (
+      Id         INTEGER PRIMARY KEY,
+      At         DATETIME,
+      Actor      TEXT,
+      Action     TEXT,
+      Subject    TEXT,
+      Detail     TEXT
+    )`,
+	`ALTER TABLE participants ADD COLUMN ReadyStage TEXT DEFAULT ''`,
+	`ALTER TABLE contents ADD COLUMN Version INTEGER DEFAULT 1`,
+	`ALTER TABLE actions ADD COLUMN IssuePending BOOLEAN DEFAULT 0`,
+	// DeleteCard used to leave the card's contents and votes behind.
+	`DELETE FROM votes WHERE Card NOT IN (SELECT Id FROM cards)`,
+	`DELETE FROM contents WHERE Card NOT IN (SELECT Id FROM cards)`,
+}
+
+func (d *Database) migrate() error {
+	version, err := d.Version()
+	if err != nil {
+		return err
+	}
+
+	for ; version < len(migrations); version++ {
+		tx, err := d.begin()
+		if err != nil {
+			return err
+		}
+
+		if _, err = tx.Exec(migrations[version]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %v", version+1, err)
+		}
+
+		if _, err = tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Version returns the number of migrations that have been applied.
+func (d *Database) Version() (int, error) {
+	var version int
+	err := d.queryRow("PRAGMA user_version").Scan(&version)
+
+	return version, err
+}
+
+// expectRows returns sql.ErrNoRows if the statement did not affect any rows.
+func expectRows(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err == nil && n == 0 {
+		err = sql.ErrNoRows
+	}
+
+	return err
+}
+
 func (d *Database) Close() error {
 	return d.db.Close()
 }
@@ -0,0 +1,152 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "retro_db_query_duration_seconds",
+	Help:    "Time taken to run database statements.",
+	Buckets: prometheus.DefBuckets,
+}, []string{"statement"})
+
+var tracer = otel.Tracer("hawx.me/code/retro/database")
+
+// WithContext returns a copy of the Database that traces its statements as
+// children of any span in ctx.
+func (d *Database) WithContext(ctx context.Context) *Database {
+	c := *d
+	c.ctx = ctx
+	return &c
+}
+
+func (d *Database) context() context.Context {
+	if d.ctx == nil {
+		return context.Background()
+	}
+	return d.ctx
+}
+
+// instrument starts a span for the query, and returns a function that must be
+// called with the result once it has run.
+func instrument(ctx context.Context, query string) (context.Context, func(error)) {
+	name := statementName(query)
+	start := time.Now()
+
+	ctx, span := tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "sqlite"),
+			attribute.String("db.statement", query)))
+
+	return ctx, func(err error) {
+		queryDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+
+		if err != nil && err != sql.ErrNoRows {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+// statementName gives a short name for the query using its kind and the first
+// table it refers to, e.g. "select cards", so that the metrics have a small
+// number of labels.
+func statementName(query string) string {
+	fields := strings.Fields(strings.ToLower(query))
+	if len(fields) == 0 {
+		return ""
+	}
+
+	kind := fields[0]
+	var before string
+	switch kind {
+	case "select", "delete":
+		before = "from"
+	case "insert":
+		before = "into"
+	case "update":
+		return kind + " " + strings.Trim(fields[min(1, len(fields)-1)], `"`)
+	default:
+		return kind
+	}
+
+	for i, field := range fields[:len(fields)-1] {
+		if field == before {
+			return kind + " " + strings.Trim(fields[i+1], `"(`)
+		}
+	}
+
+	return kind
+}
+
+func (d *Database) exec(query string, args ...interface{}) (sql.Result, error) {
+	ctx, done := instrument(d.context(), query)
+	res, err := d.db.ExecContext(ctx, query, args...)
+	done(err)
+	return res, err
+}
+
+func (d *Database) query(query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, done := instrument(d.context(), query)
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	done(err)
+	return rows, err
+}
+
+func (d *Database) queryRow(query string, args ...interface{}) *sql.Row {
+	ctx, done := instrument(d.context(), query)
+	row := d.db.QueryRowContext(ctx, query, args...)
+	done(row.Err())
+	return row
+}
+
+// instrumentedTx wraps a transaction so that its statements are measured and
+// traced.
+type instrumentedTx struct {
+	*sql.Tx
+	ctx context.Context
+}
+
+func (d *Database) begin() (*instrumentedTx, error) {
+	t, err := d.db.BeginTx(d.context(), nil)
+	return &instrumentedTx{t, d.context()}, err
+}
+
+func (t *instrumentedTx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	ctx, done := instrument(t.ctx, query)
+	res, err := t.Tx.ExecContext(ctx, query, args...)
+	done(err)
+	return res, err
+}
+
+func (t *instrumentedTx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, done := instrument(t.ctx, query)
+	rows, err := t.Tx.QueryContext(ctx, query, args...)
+	done(err)
+	return rows, err
+}
+
+func (t *instrumentedTx) QueryRow(query string, args ...interface{}) *sql.Row {
+	ctx, done := instrument(t.ctx, query)
+	row := t.Tx.QueryRowContext(ctx, query, args...)
+	done(row.Err())
+	return row
+}
+
+// Ping checks that the database can be queried.
+func (d *Database) Ping() error {
+	var one int
+	return d.queryRow("SELECT 1").Scan(&one)
+}
@@ -1,15 +1,7 @@
 package database
 
-func (d *Database) AddParticipant(retroId, username string) error {
-	_, err := d.db.Exec("INSERT INTO participants(Retro, Username) VALUES (?, ?)",
-		retroId,
-		username)
-
-	return err
-}
-
 func (d *Database) GetParticipants(retroId string) (participants []string, err error) {
-	rows, err := d.db.Query("SELECT Username FROM participants WHERE Retro = ?",
+	rows, err := d.query("SELECT Username FROM participants WHERE Retro = ?",
 		retroId)
 	if err != nil {
 		return participants, err
@@ -26,3 +18,28 @@ func (d *Database) GetParticipants(retroId string) (participants []string, err e
 
 	return participants, rows.Err()
 }
+
+// SetReady marks the participant as done with stage, or not done when stage is
+// empty. The flag is cleared whenever the retro's stage changes.
+func (d *Database) SetReady(retroId, username, stage string) error {
+	res, err := d.exec("UPDATE participants SET ReadyStage=? WHERE Retro=? AND Username=?",
+		stage,
+		retroId,
+		username)
+	if err != nil {
+		return err
+	}
+
+	return expectRows(res)
+}
+
+// CountReady returns how many of the retro's participants are done with stage,
+// out of the total.
+func (d *Database) CountReady(retroId, stage string) (ready, total int, err error) {
+	row := d.queryRow("SELECT COUNT(*), COALESCE(SUM(ReadyStage = ?), 0) FROM participants WHERE Retro = ?",
+		stage,
+		retroId)
+
+	err = row.Scan(&total, &ready)
+	return
+}
@@ -0,0 +1,169 @@
+package database
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// UserExport is everything stored about a user.
+type UserExport struct {
+	Username     string
+	Email        string
+	Participated []Retro
+	Contents     []AuthoredContent
+	Votes        []Vote
+	Actions      []Action
+	Teams        []Team
+}
+
+// AuthoredContent is a Content along with the retro it was written in.
+type AuthoredContent struct {
+	Content
+	Retro string
+}
+
+// ExportUser collects everything tied to username.
+func (d *Database) ExportUser(username string) (export UserExport, err error) {
+	user, err := d.GetUser(username)
+	if err != nil {
+		return export, err
+	}
+	export.Username = user.Username
+	export.Email = user.Email
+
+	rows, err := d.query(`
+    SELECT retros.Id, retros.Name, retros.Stage, retros.CreatedAt, retros.Team, retros.ScheduledAt, retros.ArchivedAt
+    FROM retros
+    INNER JOIN participants
+      ON retros.Id = participants.Retro
+    WHERE participants.Username = ?
+    ORDER BY retros.CreatedAt`,
+		username)
+	if err != nil {
+		return export, err
+	}
+	for rows.Next() {
+		retro, err := scanRetro(rows)
+		if err != nil {
+			rows.Close()
+			return export, err
+		}
+		export.Participated = append(export.Participated, retro)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return export, err
+	}
+
+	rows, err = d.query(`
+    SELECT contents.Id, contents.Card, contents.Text, contents.Author, contents.Version, IFNULL(columns.Retro, '')
+    FROM contents
+    LEFT JOIN cards ON contents.Card = cards.Id
+    LEFT JOIN columns ON cards.Column = columns.Id
+    WHERE contents.Author = ?`,
+		username)
+	if err != nil {
+		return export, err
+	}
+	for rows.Next() {
+		var content AuthoredContent
+		if err = rows.Scan(&content.Id, &content.Card, &content.Text, &content.Author, &content.Version, &content.Retro); err != nil {
+			rows.Close()
+			return export, err
+		}
+		if content.Text, err = open(d.aead, content.Id, content.Text); err != nil {
+			rows.Close()
+			return export, err
+		}
+		export.Contents = append(export.Contents, content)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return export, err
+	}
+
+	rows, err = d.query("SELECT Username, Card, COUNT(*) FROM votes WHERE Username = ? GROUP BY Username, Card",
+		username)
+	if err != nil {
+		return export, err
+	}
+	for rows.Next() {
+		var vote Vote
+		if err = rows.Scan(&vote.Username, &vote.Card, &vote.Count); err != nil {
+			rows.Close()
+			return export, err
+		}
+		export.Votes = append(export.Votes, vote)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return export, err
+	}
+
+	export.Actions, err = d.queryActions("SELECT Id, Retro, Text, Owner, DueAt, Closed, IssueKey, IssueURL, IssuePending FROM actions WHERE Owner=?",
+		username)
+	if err != nil {
+		return export, err
+	}
+
+	export.Teams, err = d.GetTeams(username)
+
+	return export, err
+}
+
+// EraseUser removes the user, replacing them with a pseudonym wherever they
+// are referenced. Their votes are kept so that counts do not change, but are
+// no longer attributed to anyone. The pseudonym is returned.
+func (d *Database) EraseUser(username string) (string, error) {
+	if _, err := d.GetUser(username); err != nil {
+		return "", err
+	}
+
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	pseudonym := "deleted-" + hex.EncodeToString(b)
+
+	tx, err := d.begin()
+	if err != nil {
+		return "", err
+	}
+
+	for _, query := range []string{
+		"UPDATE contents SET Author=? WHERE Author=?",
+		"UPDATE participants SET Username=? WHERE Username=?",
+		"UPDATE actions SET Owner=? WHERE Owner=?",
+		"UPDATE audit SET Subject=? WHERE Subject=?",
+	} {
+		if _, err = tx.Exec(query, pseudonym, username); err != nil {
+			tx.Rollback()
+			return "", err
+		}
+	}
+
+	for _, query := range []string{
+		"UPDATE votes SET Username=NULL WHERE Username=?",
+		"DELETE FROM members WHERE Username=?",
+		"DELETE FROM users WHERE Username=?",
+	} {
+		if _, err = tx.Exec(query, username); err != nil {
+			tx.Rollback()
+			return "", err
+		}
+	}
+
+	_, err = tx.Exec("INSERT INTO audit(At, Actor, Action, Subject, Detail) VALUES (?, ?, ?, ?, ?)",
+		time.Now(),
+		"admin",
+		"erase",
+		pseudonym,
+		"user erased")
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	return pseudonym, tx.Commit()
+}
@@ -1,41 +1,92 @@
 package database
 
-import "time"
+import (
+	"database/sql"
+	"time"
+)
 
 type Retro struct {
 	Id        string
 	Name      string
 	Stage     string
 	CreatedAt time.Time
+
+	// Team and ScheduledAt are set for retros created from a team's schedule.
+	Team        string
+	ScheduledAt time.Time
+
+	// ArchivedAt is set once the retro has passed its retention period, it will
+	// then be deleted.
+	ArchivedAt time.Time
 }
 
-func (d *Database) AddRetro(retro Retro) error {
-	_, err := d.db.Exec("INSERT INTO retros(Id, Name, Stage, CreatedAt) VALUES (?, ?, ?, ?)",
+// AddRetro creates the retro along with its columns and participants, or
+// nothing if any of them fail.
+func (d *Database) AddRetro(retro Retro, columns []Column, participants []string) error {
+	var scheduledAt interface{}
+	if !retro.ScheduledAt.IsZero() {
+		scheduledAt = retro.ScheduledAt
+	}
+
+	tx, err := d.begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO retros(Id, Name, Stage, CreatedAt, Team, ScheduledAt) VALUES (?, ?, ?, ?, ?, ?)",
 		retro.Id,
 		retro.Name,
 		retro.Stage,
-		retro.CreatedAt)
+		retro.CreatedAt,
+		retro.Team,
+		scheduledAt)
 
-	return err
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for _, column := range columns {
+		_, err = tx.Exec("INSERT INTO columns(Id, Retro, Name, \"Order\") VALUES (?, ?, ?, ?)",
+			column.Id,
+			retro.Id,
+			column.Name,
+			column.Order)
+
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	for _, participant := range participants {
+		_, err = tx.Exec("INSERT OR IGNORE INTO participants(Retro, Username) VALUES (?, ?)",
+			retro.Id,
+			participant)
+
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
 }
 
 func (d *Database) GetRetro(id string) (Retro, error) {
-	row := d.db.QueryRow("SELECT Id, Name, Stage, CreatedAt FROM retros WHERE Id=?",
+	row := d.queryRow("SELECT Id, Name, Stage, CreatedAt, Team, ScheduledAt, ArchivedAt FROM retros WHERE Id=?",
 		id)
 
-	var retro Retro
-	err := row.Scan(&retro.Id, &retro.Name, &retro.Stage, &retro.CreatedAt)
-
-	return retro, err
+	return scanRetro(row)
 }
 
 func (d *Database) GetRetros(username string) (retros []Retro, err error) {
-	rows, err := d.db.Query(`
-    SELECT retros.Id, retros.Name, retros.Stage, retros.CreatedAt
+	rows, err := d.query(`
+    SELECT retros.Id, retros.Name, retros.Stage, retros.CreatedAt, retros.Team, retros.ScheduledAt, retros.ArchivedAt
     FROM retros
     INNER JOIN participants
       ON retros.Id = participants.Retro
-    WHERE participants.Username = ?
+    WHERE participants.Username = ? AND retros.ArchivedAt IS NULL
     ORDER BY retros.CreatedAt`,
 		username)
 	if err != nil {
@@ -44,8 +95,27 @@ func (d *Database) GetRetros(username string) (retros []Retro, err error) {
 	defer rows.Close()
 
 	for rows.Next() {
-		var retro Retro
-		if err = rows.Scan(&retro.Id, &retro.Name, &retro.Stage, &retro.CreatedAt); err != nil {
+		retro, err := scanRetro(rows)
+		if err != nil {
+			return retros, err
+		}
+		retros = append(retros, retro)
+	}
+
+	return retros, rows.Err()
+}
+
+// GetAllRetros returns every retro, ordered by when they were created.
+func (d *Database) GetAllRetros() (retros []Retro, err error) {
+	rows, err := d.query("SELECT Id, Name, Stage, CreatedAt, Team, ScheduledAt, ArchivedAt FROM retros ORDER BY CreatedAt")
+	if err != nil {
+		return retros, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		retro, err := scanRetro(rows)
+		if err != nil {
 			return retros, err
 		}
 		retros = append(retros, retro)
@@ -54,10 +124,109 @@ func (d *Database) GetRetros(username string) (retros []Retro, err error) {
 	return retros, rows.Err()
 }
 
-func (d *Database) SetStage(id, stage string) error {
-	_, err := d.db.Exec("UPDATE retros SET Stage=? WHERE Id=?",
-		stage,
+// GetTeamRetros returns the retros that have been created from the team's
+// schedule, ordered by when they are scheduled.
+func (d *Database) GetTeamRetros(teamId string) (retros []Retro, err error) {
+	rows, err := d.query(`
+    SELECT Id, Name, Stage, CreatedAt, Team, ScheduledAt, ArchivedAt
+    FROM retros
+    WHERE Team = ? AND ScheduledAt IS NOT NULL
+    ORDER BY ScheduledAt`,
+		teamId)
+	if err != nil {
+		return retros, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		retro, err := scanRetro(rows)
+		if err != nil {
+			return retros, err
+		}
+		retros = append(retros, retro)
+	}
+
+	return retros, rows.Err()
+}
+
+// SetStage moves the retro on to stage, clearing everyone's ready flag. If the
+// retro is already at stage nothing is changed and changed is false.
+func (d *Database) SetStage(id, stage string) (changed bool, err error) {
+	tx, err := d.begin()
+	if err != nil {
+		return false, err
+	}
+
+	res, err := tx.Exec("UPDATE retros SET Stage=? WHERE Id=? AND Stage<>?", stage, id, stage)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		tx.Rollback()
+		return false, err
+	}
+
+	if _, err = tx.Exec("UPDATE participants SET ReadyStage='' WHERE Retro=?", id); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+func (d *Database) ArchiveRetro(id string, at time.Time) error {
+	_, err := d.exec("UPDATE retros SET ArchivedAt=? WHERE Id=?",
+		at,
 		id)
 
 	return err
 }
+
+// DeleteRetro removes the retro along with its columns, cards, contents, votes,
+// actions and participants.
+func (d *Database) DeleteRetro(id string) error {
+	tx, err := d.begin()
+	if err != nil {
+		return err
+	}
+
+	for _, query := range []string{
+		"DELETE FROM votes WHERE Card IN (SELECT cards.Id FROM cards INNER JOIN columns ON cards.Column = columns.Id WHERE columns.Retro=?)",
+		"DELETE FROM contents WHERE Card IN (SELECT cards.Id FROM cards INNER JOIN columns ON cards.Column = columns.Id WHERE columns.Retro=?)",
+		"DELETE FROM cards WHERE Column IN (SELECT Id FROM columns WHERE Retro=?)",
+		"DELETE FROM columns WHERE Retro=?",
+		"DELETE FROM actions WHERE Retro=?",
+		"DELETE FROM participants WHERE Retro=?",
+	} {
+		if _, err = tx.Exec(query, id); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	res, err := tx.Exec("DELETE FROM retros WHERE Id=?", id)
+	if err == nil {
+		err = expectRows(res)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRetro(row scanner) (Retro, error) {
+	var retro Retro
+	var scheduledAt, archivedAt sql.NullTime
+	err := row.Scan(&retro.Id, &retro.Name, &retro.Stage, &retro.CreatedAt, &retro.Team, &scheduledAt, &archivedAt)
+	retro.ScheduledAt = scheduledAt.Time
+	retro.ArchivedAt = archivedAt.Time
+
+	return retro, err
+}
@@ -0,0 +1,145 @@
+package database
+
+import (
+	"strings"
+	"time"
+)
+
+// Team is a group of users that hold retros on a regular schedule.
+type Team struct {
+	Id   string
+	Name string
+
+	// Columns are the names of the columns each scheduled retro starts with.
+	Columns []string
+
+	// EveryWeeks is how often the team holds a retro, if zero the team has no
+	// schedule.
+	EveryWeeks int
+
+	// NextAt is the time of the next retro that has not yet been created.
+	NextAt time.Time
+
+	// Length is how long each retro is expected to last.
+	Length time.Duration
+
+	// RetentionDays is how long the team's retros are kept for, if zero the
+	// global retention period is used.
+	RetentionDays int
+}
+
+func (d *Database) AddTeam(team Team, members []string) error {
+	tx, err := d.begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO teams(Id, Name, Columns, EveryWeeks, NextAt, Length, RetentionDays) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		team.Id,
+		team.Name,
+		strings.Join(team.Columns, "\n"),
+		team.EveryWeeks,
+		team.NextAt,
+		int64(team.Length/time.Minute),
+		team.RetentionDays)
+
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for _, member := range members {
+		_, err = tx.Exec("INSERT OR IGNORE INTO members(Team, Username) VALUES (?, ?)",
+			team.Id,
+			member)
+
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (d *Database) SetTeamNextAt(id string, nextAt time.Time) error {
+	_, err := d.exec("UPDATE teams SET NextAt=? WHERE Id=?",
+		nextAt,
+		id)
+
+	return err
+}
+
+func (d *Database) GetTeam(id string) (Team, error) {
+	row := d.queryRow("SELECT Id, Name, Columns, EveryWeeks, NextAt, Length, RetentionDays FROM teams WHERE Id=?",
+		id)
+
+	return scanTeam(row)
+}
+
+// GetTeams returns the teams that username is a member of.
+func (d *Database) GetTeams(username string) (teams []Team, err error) {
+	return d.queryTeams(`
+    SELECT teams.Id, teams.Name, teams.Columns, teams.EveryWeeks, teams.NextAt, teams.Length, teams.RetentionDays
+    FROM teams
+    INNER JOIN members
+      ON teams.Id = members.Team
+    WHERE members.Username = ?
+    ORDER BY teams.Name`,
+		username)
+}
+
+// GetScheduledTeams returns all teams that have a schedule.
+func (d *Database) GetScheduledTeams() (teams []Team, err error) {
+	return d.queryTeams("SELECT Id, Name, Columns, EveryWeeks, NextAt, Length, RetentionDays FROM teams WHERE EveryWeeks > 0")
+}
+
+func (d *Database) GetMembers(teamId string) (members []string, err error) {
+	rows, err := d.query("SELECT Username FROM members WHERE Team = ?",
+		teamId)
+	if err != nil {
+		return members, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var member string
+		if err = rows.Scan(&member); err != nil {
+			return members, err
+		}
+		members = append(members, member)
+	}
+
+	return members, rows.Err()
+}
+
+func (d *Database) queryTeams(query string, args ...interface{}) (teams []Team, err error) {
+	rows, err := d.query(query, args...)
+	if err != nil {
+		return teams, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		team, err := scanTeam(rows)
+		if err != nil {
+			return teams, err
+		}
+		teams = append(teams, team)
+	}
+
+	return teams, rows.Err()
+}
+
+func scanTeam(row scanner) (Team, error) {
+	var team Team
+	var columns string
+	var length int64
+	err := row.Scan(&team.Id, &team.Name, &columns, &team.EveryWeeks, &team.NextAt, &length, &team.RetentionDays)
+	if columns != "" {
+		team.Columns = strings.Split(columns, "\n")
+	}
+	team.Length = time.Duration(length) * time.Minute
+
+	return team, err
+}
@@ -2,29 +2,31 @@ package database
 
 type User struct {
 	Username string
+	Email    string
 	Token    string
 }
 
 func (d *Database) EnsureUser(user User) error {
-	_, err := d.db.Exec("INSERT OR REPLACE INTO users(Username, Token) VALUES(?, ?)",
+	_, err := d.exec("INSERT OR REPLACE INTO users(Username, Email, Token) VALUES(?, ?, ?)",
 		user.Username,
+		user.Email,
 		user.Token)
 
 	return err
 }
 
 func (d *Database) GetUser(username string) (User, error) {
-	row := d.db.QueryRow("SELECT Username, Token FROM users WHERE Username=?",
+	row := d.queryRow("SELECT Username, Email, Token FROM users WHERE Username=?",
 		username)
 
 	var user User
-	err := row.Scan(&user.Username, &user.Token)
+	err := row.Scan(&user.Username, &user.Email, &user.Token)
 
 	return user, err
 }
 
 func (d *Database) GetUsers() (users []User, err error) {
-	rows, err := d.db.Query("SELECT Username, Token FROM users")
+	rows, err := d.query("SELECT Username, Email, Token FROM users")
 	if err != nil {
 		return users, err
 	}
@@ -32,7 +34,7 @@ func (d *Database) GetUsers() (users []User, err error) {
 
 	for rows.Next() {
 		var user User
-		if err = rows.Scan(&user.Username, &user.Token); err != nil {
+		if err = rows.Scan(&user.Username, &user.Email, &user.Token); err != nil {
 			return users, err
 		}
 		users = append(users, user)
@@ -40,3 +42,14 @@ func (d *Database) GetUsers() (users []User, err error) {
 
 	return users, rows.Err()
 }
+
+// RevokeUser clears the user's token, so they must sign in again.
+func (d *Database) RevokeUser(username string) error {
+	res, err := d.exec("UPDATE users SET Token='' WHERE Username=?",
+		username)
+	if err != nil {
+		return err
+	}
+
+	return expectRows(res)
+}
@@ -7,14 +7,14 @@ type Vote struct {
 }
 
 func (d *Database) Vote(username, cardId string) error {
-	_, err := d.db.Exec("INSERT INTO votes(Username, Card) VALUES (?, ?)",
+	_, err := d.exec("INSERT INTO votes(Username, Card) VALUES (?, ?)",
 		username, cardId)
 
 	return err
 }
 
 func (d *Database) Unvote(username, cardId string) error {
-	_, err := d.db.Exec("DELETE FROM votes WHERE Id=(SELECT MIN(Id) FROM votes WHERE Username=? AND Card=?)",
+	_, err := d.exec("DELETE FROM votes WHERE Id=(SELECT MIN(Id) FROM votes WHERE Username=? AND Card=?)",
 		username, cardId)
 
 	return err
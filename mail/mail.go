@@ -0,0 +1,185 @@
+// Package mail sends retro summaries and action reminders by email.
+package mail
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+)
+
+// Summary is the data available to the summary template.
+type Summary struct {
+	Retro   string
+	Date    time.Time
+	Columns []Column
+	Actions []Action
+}
+
+type Column struct {
+	Name  string
+	Cards []Card
+}
+
+type Card struct {
+	Texts []string
+	Votes int
+}
+
+type Action struct {
+	Retro string
+	Text  string
+	Owner string
+	DueAt time.Time
+	URL   string
+}
+
+// Reminder is the data available to the reminder template.
+type Reminder struct {
+	Action
+}
+
+// Mailer sends mail using an SMTP server. Each template must define a
+// "subject" and a "body" template.
+type Mailer struct {
+	addr     string
+	username string
+	password string
+	from     string
+
+	summary  *template.Template
+	reminder *template.Template
+}
+
+// New creates a Mailer that sends mail through the SMTP server at addr
+// ("host:port"). If username is empty no authentication is attempted. The
+// summary and reminder templates are read from the paths given, or if empty
+// the default templates are used.
+func New(addr, username, password, from, summaryPath, reminderPath string) (*Mailer, error) {
+	if addr == "" || from == "" {
+		return nil, errors.New("mail: addr and from must be given")
+	}
+
+	summary, err := parseTemplate("summary", summaryPath, defaultSummary)
+	if err != nil {
+		return nil, err
+	}
+
+	reminder, err := parseTemplate("reminder", reminderPath, defaultReminder)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Mailer{
+		addr:     addr,
+		username: username,
+		password: password,
+		from:     from,
+		summary:  summary,
+		reminder: reminder,
+	}, nil
+}
+
+func parseTemplate(name, path, fallback string) (*template.Template, error) {
+	text := fallback
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		text = string(data)
+	}
+
+	return template.New(name).Funcs(template.FuncMap{
+		"date": func(t time.Time) string { return t.Format("Mon 2 Jan 2006") },
+	}).Parse(text)
+}
+
+// SendSummary sends the summary of a retro to each address in to. It tries
+// every address, returning the errors for any that failed.
+func (m *Mailer) SendSummary(to []string, summary Summary) error {
+	var errs []error
+	for _, addr := range to {
+		if err := m.send(addr, m.summary, summary); err != nil {
+			errs = append(errs, fmt.Errorf("mail: send summary to %s: %w", addr, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// SendReminder sends a reminder to the owner of an action.
+func (m *Mailer) SendReminder(to string, reminder Reminder) error {
+	return m.send(to, m.reminder, reminder)
+}
+
+func (m *Mailer) send(to string, tmpl *template.Template, data interface{}) error {
+	if strings.ContainsAny(m.from+to, "\r\n") {
+		return errors.New("mail: address contains a line break")
+	}
+
+	var subject, body bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return err
+	}
+	if err := tmpl.ExecuteTemplate(&body, "body", data); err != nil {
+		return err
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", m.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", encodeSubject(subject.String()))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body.String(), "\n", "\r\n"))
+
+	var auth smtp.Auth
+	if m.username != "" {
+		host, _, _ := net.SplitHostPort(m.addr)
+		auth = smtp.PlainAuth("", m.username, m.password, host)
+	}
+
+	return smtp.SendMail(m.addr, auth, m.from, []string{to}, msg.Bytes())
+}
+
+// encodeSubject collapses the whitespace in subject, so that text from a retro
+// can't add headers, and encodes it if it is not plain ASCII.
+func encodeSubject(subject string) string {
+	subject = strings.Join(strings.Fields(subject), " ")
+
+	for _, r := range subject {
+		if r > unicode.MaxASCII {
+			return mime.QEncoding.Encode("utf-8", subject)
+		}
+	}
+
+	return subject
+}
+
+const defaultSummary = `{{define "subject"}}Summary of {{.Retro}}{{end}}
+{{- define "body"}}Here is what happened in {{.Retro}} on {{date .Date}}.
+{{range .Columns}}
+{{.Name}}
+{{range .Cards}}  - {{range $i, $t := .Texts}}{{if $i}} / {{end}}{{$t}}{{end}}{{if .Votes}} ({{.Votes}} votes){{end}}
+{{else}}  (no cards)
+{{end}}{{end}}
+{{- if .Actions}}
+Actions
+{{range .Actions}}  - {{.Text}}{{if .Owner}} ({{.Owner}}{{if not .DueAt.IsZero}}, due {{date .DueAt}}{{end}}){{end}}{{if .URL}} {{.URL}}{{end}}
+{{end}}{{end}}{{end}}`
+
+const defaultReminder = `{{define "subject"}}Reminder: {{.Text}}{{end}}
+{{- define "body"}}The action "{{.Text}}" from {{.Retro}} is due on {{date .DueAt}}.
+{{if .URL}}
+{{.URL}}
+{{end}}{{end}}`
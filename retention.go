@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"text/tabwriter"
+	"time"
+
+	"hawx.me/code/retro/database"
+)
+
+type retentionConfig struct {
+	// Days is how long retros are kept before being archived, if zero retros
+	// are kept forever unless their team sets a period.
+	Days int `toml:"days"`
+
+	// GraceDays is how long archived retros are kept before being deleted.
+	GraceDays int `toml:"graceDays"`
+}
+
+type purgeStep struct {
+	Action string
+	Retro  database.Retro
+}
+
+// planPurge works out which retros should be archived or deleted at now. Each
+// retro is kept for its team's retention period, or the global period if the
+// team does not set one.
+func planPurge(db *database.Database, conf retentionConfig, now time.Time) ([]purgeStep, error) {
+	retros, err := db.GetAllRetros()
+	if err != nil {
+		return nil, err
+	}
+
+	teamDays := map[string]int{}
+	var steps []purgeStep
+
+	for _, retro := range retros {
+		if !retro.ArchivedAt.IsZero() {
+			if retro.ArchivedAt.AddDate(0, 0, conf.GraceDays).Before(now) {
+				steps = append(steps, purgeStep{"delete", retro})
+			}
+			continue
+		}
+
+		days := conf.Days
+		if retro.Team != "" {
+			teamRetention, ok := teamDays[retro.Team]
+			if !ok {
+				if team, err := db.GetTeam(retro.Team); err == nil {
+					teamRetention = team.RetentionDays
+				}
+				teamDays[retro.Team] = teamRetention
+			}
+			if teamRetention > 0 {
+				days = teamRetention
+			}
+		}
+
+		if days > 0 && retro.CreatedAt.AddDate(0, 0, days).Before(now) {
+			steps = append(steps, purgeStep{"archive", retro})
+		}
+	}
+
+	return steps, nil
+}
+
+// purge carries out the steps, recording each in the audit log.
+func purge(db *database.Database, steps []purgeStep, now time.Time) error {
+	for _, step := range steps {
+		var err error
+		switch step.Action {
+		case "archive":
+			err = db.ArchiveRetro(step.Retro.Id, now)
+		case "delete":
+			err = db.DeleteRetro(step.Retro.Id)
+		}
+		if err != nil {
+			return err
+		}
+
+		err = db.AddAudit(database.Audit{
+			At:      now,
+			Actor:   "retention",
+			Action:  step.Action,
+			Subject: step.Retro.Id,
+			Detail:  step.Retro.Name,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writePurgeReport(w io.Writer, steps []purgeStep) {
+	if len(steps) == 0 {
+		fmt.Fprintln(w, "nothing to purge")
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, step := range steps {
+		fmt.Fprintf(tw, "%s\t%s\t%s\tcreated %s\n", step.Action, step.Retro.Id, step.Retro.Name, step.Retro.CreatedAt.Format("2006-01-02"))
+	}
+	tw.Flush()
+}
+
+// purgeRetros periodically applies the retention policy.
+func purgeRetros(ctx context.Context, db *database.Database, conf retentionConfig, every time.Duration) {
+	for range ticks(ctx, every) {
+		now := time.Now()
+
+		steps, err := planPurge(db, conf, now)
+		if err != nil {
+			slog.Error("purge: plan", "err", err)
+			continue
+		}
+
+		if err := purge(db, steps, now); err != nil {
+			slog.Error("purge", "err", err)
+		}
+	}
+}
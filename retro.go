@@ -1,17 +1,37 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
 	"flag"
+	"fmt"
 	"github.com/BurntSushi/toml"
 	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"hawx.me/code/retro/auth"
+	"hawx.me/code/retro/calendar"
 	"hawx.me/code/retro/database"
+	"hawx.me/code/retro/mail"
 	"hawx.me/code/retro/sock"
-	"hawx.me/code/serve"
-	"log"
+	"hawx.me/code/retro/tracker"
+	"io"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 )
 
@@ -26,10 +46,6 @@ type msg struct {
 	Args []string `json:"args"`
 }
 
-type errorData struct {
-	Error string `json:"error"`
-}
-
 type stageData struct {
 	Stage string `json:"stage"`
 }
@@ -49,10 +65,33 @@ type cardData struct {
 }
 
 type contentData struct {
-	ColumnId string `json:"columnId"`
-	CardId   string `json:"cardId"`
+	ColumnId  string `json:"columnId"`
+	CardId    string `json:"cardId"`
 	ContentId string `json:"contentId"`
-	CardText string `json:"cardText"`
+	CardText  string `json:"cardText"`
+	Version   int    `json:"version"`
+}
+
+// conflictError is returned by "edit" when the content has changed since the
+// version being edited. The client is sent the current content, along with the
+// text it tried to save, so it can merge the changes and try again.
+type conflictError struct {
+	Current contentData
+	Draft   string
+}
+
+func (e *conflictError) Error() string {
+	return "content " + e.Current.ContentId + " is at version " + strconv.Itoa(e.Current.Version)
+}
+
+type conflictData struct {
+	Error string `json:"error"`
+	contentData
+	Draft string `json:"draft"`
+}
+
+func (e *conflictError) ClientData() interface{} {
+	return conflictData{"conflict", e.Current, e.Draft}
 }
 
 type moveData struct {
@@ -95,25 +134,96 @@ type retroData struct {
 	Participants []string  `json:"participants"`
 }
 
+type actionData struct {
+	ActionId string    `json:"actionId"`
+	Text     string    `json:"text"`
+	Owner    string    `json:"owner"`
+	DueAt    time.Time `json:"dueAt"`
+	Closed   bool      `json:"closed"`
+	IssueKey string    `json:"issueKey"`
+	IssueURL string    `json:"issueUrl"`
+}
+
+type teamData struct {
+	Id         string    `json:"id"`
+	Name       string    `json:"name"`
+	Members    []string  `json:"members"`
+	EveryWeeks int       `json:"everyWeeks"`
+	NextAt     time.Time `json:"nextAt"`
+	Calendar   string    `json:"calendar"`
+}
+
+type readyData struct {
+	Stage string `json:"stage"`
+	Ready int    `json:"ready"`
+	Total int    `json:"total"`
+}
+
 type Room struct {
-	server *sock.Server
-	db     *database.Database
+	server  *sock.Server
+	db      *database.Database
+	tracker tracker.Tracker
+	mailer  *mail.Mailer
+	typing  *typingTracker
+	limits  inputLimits
 
 	mu    sync.RWMutex
 	users map[string]string
+
+	// tasks are the goroutines started with background.
+	tasks sync.WaitGroup
 }
 
 func NewRoom(db *database.Database) *Room {
 	room := &Room{
 		db:     db,
 		server: sock.NewServer(),
+		limits: defaultInputLimits,
 	}
+	room.typing = newTypingTracker(room.server)
 
 	registerHandlers(room, room.server)
 
 	return room
 }
 
+// background runs task in a new goroutine, which is waited for before the
+// database is closed.
+func (r *Room) background(task func()) {
+	r.tasks.Add(1)
+	go func() {
+		defer r.tasks.Done()
+		task()
+	}()
+}
+
+// ticks returns a channel that receives every interval, and is closed once ctx
+// is done.
+func ticks(ctx context.Context, every time.Duration) <-chan time.Time {
+	ch := make(chan time.Time)
+
+	go func() {
+		defer close(ch)
+		ticker := time.NewTicker(every)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case t := <-ticker.C:
+				select {
+				case ch <- t:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return ch
+}
+
 func boolToString(b bool) string {
 	if b {
 		return "true"
@@ -121,9 +231,10 @@ func boolToString(b bool) string {
 	return "false"
 }
 
-func (r *Room) AddUser(user, token string) {
+func (r *Room) AddUser(user, email, token string) {
 	r.db.EnsureUser(database.User{
 		Username: user,
+		Email:    email,
 		Token:    token,
 	})
 }
@@ -131,7 +242,20 @@ func (r *Room) AddUser(user, token string) {
 func (r *Room) IsUser(user, token string) bool {
 	found, err := r.db.GetUser(user)
 
-	return err == nil && found.Token == token
+	return err == nil && found.Token != "" && found.Token == token
+}
+
+// requireRetro rejects ops that act on a retro from connections that haven't
+// joined one.
+func requireRetro(next sock.Handler) sock.Handler {
+	return func(conn *sock.Conn, data []byte) {
+		if conn.RetroId == "" {
+			conn.Fail(sock.Error("not_joined"))
+			return
+		}
+
+		next(conn, data)
+	}
 }
 
 func registerHandlers(r *Room, mux *sock.Server) {
@@ -139,83 +263,119 @@ func registerHandlers(r *Room, mux *sock.Server) {
 		return r.IsUser(auth.Username, auth.Token)
 	})
 
-	mux.Handle("joinRetro", func(conn *sock.Conn, data []byte) {
-		var args struct {
-			RetroId string
-		}
-		if err := json.Unmarshal(data, &args); err != nil {
-			log.Println("joinRetro:", err)
-			return
+	sock.HandleFunc(mux, "joinRetro", func(conn *sock.Conn, args struct {
+		RetroId string
+	}) (struct{}, error) {
+		db := r.db.WithContext(conn.Context())
+
+		if err := r.limits.name("retroId", args.RetroId); err != nil {
+			return struct{}{}, err
 		}
 
-		retro, err := r.db.GetRetro(args.RetroId)
-		if err != nil {
-			log.Println("joinRetro", args.RetroId, err)
-			return
+		retro, err := db.GetRetro(args.RetroId)
+		if err == sql.ErrNoRows {
+			return struct{}{}, sock.Error("not_found")
+		} else if err != nil {
+			return struct{}{}, fmt.Errorf("get retro: %w", err)
 		}
-		conn.RetroId = args.RetroId
+		conn.Join(args.RetroId)
 
 		if retro.Stage != "" {
 			conn.Send("", "stage", stageData{retro.Stage})
+
+			if ready, err := readiness(db, args.RetroId, retro.Stage); err == nil {
+				conn.Send("", "ready", ready)
+			}
 		}
 
-		columns, err := r.db.GetColumns(args.RetroId)
+		columns, err := db.GetColumns(args.RetroId)
 		if err != nil {
-			log.Println("columns", err)
-			return
+			return struct{}{}, fmt.Errorf("get columns: %w", err)
 		}
 		for _, column := range columns {
 			conn.Send("", "column", columnData{column.Id, column.Name, column.Order})
 
-			cards, err := r.db.GetCards(conn.Name, column.Id)
+			cards, err := db.GetCards(conn.Name, column.Id)
 			if err != nil {
-				log.Println(err)
+				conn.Log().Error("get cards", "columnId", column.Id, "err", err)
 			}
 			for _, card := range cards {
 				conn.Send("", "card", cardData{column.Id, card.Id, card.Revealed, card.Votes, card.TotalVotes})
 
-				contents, _ := r.db.GetContents(card.Id)
+				contents, err := db.GetContents(card.Id)
+				if err != nil {
+					conn.Log().Error("get contents", "cardId", card.Id, "err", err)
+				}
 				for _, content := range contents {
-					conn.Send(content.Author, "content", contentData{column.Id, card.Id, content.Id, content.Text})
+					conn.Send(content.Author, "content", contentData{column.Id, card.Id, content.Id, content.Text, content.Version})
 				}
 			}
 		}
+
+		actions, err := db.GetActions(args.RetroId)
+		if err != nil {
+			return struct{}{}, fmt.Errorf("get actions: %w", err)
+		}
+		for _, action := range actions {
+			conn.Send("", "action", actionData{action.Id, action.Text, action.Owner, action.DueAt, action.Closed, action.IssueKey, action.IssueURL})
+		}
+
+		return struct{}{}, nil
 	})
 
-	mux.Handle("menu", func(conn *sock.Conn, data []byte) {
-		users, err := r.db.GetUsers()
+	sock.HandleFunc(mux, "menu", func(conn *sock.Conn, args struct{}) (struct{}, error) {
+		db := r.db.WithContext(conn.Context())
+		conn.Join("")
+
+		users, err := db.GetUsers()
 		if err != nil {
-			log.Println("users", err)
-			return
+			return struct{}{}, fmt.Errorf("get users: %w", err)
 		}
 		for _, user := range users {
 			conn.Send("", "user", userData{user.Username})
 		}
 
-		retros, err := r.db.GetRetros(conn.Name)
+		retros, err := db.GetRetros(conn.Name)
 		if err != nil {
-			log.Println("retros", err)
-			return
+			return struct{}{}, fmt.Errorf("get retros: %w", err)
 		}
 		for _, retro := range retros {
-			participants, err := r.db.GetParticipants(retro.Id)
+			participants, err := db.GetParticipants(retro.Id)
 			if err != nil {
-				log.Println("retros.participants", err)
+				conn.Log().Error("get participants", "retroId", retro.Id, "err", err)
 				continue
 			}
 
 			conn.Send("", "retro", retroData{retro.Id, retro.Name, retro.CreatedAt, participants})
 		}
-	})
 
-	mux.Handle("add", func(conn *sock.Conn, data []byte) {
-		var args struct {
-			ColumnId string
-			CardText string
+		teams, err := db.GetTeams(conn.Name)
+		if err != nil {
+			return struct{}{}, fmt.Errorf("get teams: %w", err)
 		}
-		if err := json.Unmarshal(data, &args); err != nil {
-			log.Println("add:", err)
-			return
+		for _, team := range teams {
+			members, err := db.GetMembers(team.Id)
+			if err != nil {
+				conn.Log().Error("get members", "teamId", team.Id, "err", err)
+				continue
+			}
+
+			conn.Send("", "team", teamData{team.Id, team.Name, members, team.EveryWeeks, team.NextAt, calendarPath(team.Id)})
+		}
+
+		return struct{}{}, nil
+	})
+
+	sock.HandleFunc(mux, "add", func(conn *sock.Conn, args struct {
+		ColumnId string
+		CardText string
+	}) (contentData, error) {
+		db := r.db.WithContext(conn.Context())
+
+		if err := firstError(
+			inRetro("columnId", args.ColumnId, conn.RetroId, columnRetro(db)),
+			r.limits.text("cardText", args.CardText)); err != nil {
+			return contentData{}, err
 		}
 
 		card := database.Card{
@@ -224,194 +384,722 @@ func registerHandlers(r *Room, mux *sock.Server) {
 			Revealed: false,
 		}
 
-		if err := r.db.AddCard(card); err != nil {
-			log.Println("add db:", err)
-			return
+		if err := db.AddCard(card); err != nil {
+			return contentData{}, fmt.Errorf("add card: %w", err)
 		}
 
 		content := database.Content{
-			Id:     strId(),
-			Card:   card.Id,
-			Text:   args.CardText,
-			Author: conn.Name,
+			Id:      strId(),
+			Card:    card.Id,
+			Text:    args.CardText,
+			Author:  conn.Name,
+			Version: 1,
 		}
 
-		if err := r.db.AddContent(content); err != nil {
-			log.Println("add db:", err)
-			return
+		if err := db.AddContent(content); err != nil {
+			return contentData{}, fmt.Errorf("add content: %w", err)
 		}
 
+		added := contentData{args.ColumnId, content.Card, content.Id, content.Text, content.Version}
+
 		conn.Broadcast("", "card", cardData{args.ColumnId, card.Id, card.Revealed, card.Votes, card.TotalVotes})
 
-		conn.Broadcast(content.Author, "content", contentData{args.ColumnId, content.Card, content.Id, content.Text})
-	})
+		conn.Broadcast(content.Author, "content", added)
 
-	mux.Handle("edit", func(conn *sock.Conn, data []byte) {
-		var content contentData
-		if err := json.Unmarshal(data, &content); err != nil {
-			log.Println("add:", err)
-			return
+		return added, nil
+	}, requireRetro)
+
+	sock.HandleFunc(mux, "edit", func(conn *sock.Conn, content contentData) (contentData, error) {
+		db := r.db.WithContext(conn.Context())
+
+		if err := firstError(
+			inRetro("contentId", content.ContentId, conn.RetroId, db.GetContentRetro),
+			r.limits.text("cardText", content.CardText)); err != nil {
+			return contentData{}, err
 		}
 
-		if err := r.db.UpdateContent(content.ContentId, content.CardText); err != nil {
-			log.Println("update db:", err)
-			return
-		}	
+		version, err := db.UpdateContent(content.ContentId, content.CardText, content.Version)
+		if err == database.ErrConflict {
+			current, err := db.GetContent(content.ContentId)
+			if err != nil {
+				return contentData{}, fmt.Errorf("get content: %w", err)
+			}
 
-		conn.Broadcast(conn.Name, "content", content)		
-	})	
+			return contentData{}, &conflictError{contentData{content.ColumnId, current.Card, current.Id, current.Text, current.Version}, content.CardText}
+		}
+		if err != nil {
+			return contentData{}, fmt.Errorf("update content: %w", err)
+		}
 
-	mux.Handle("move", func(conn *sock.Conn, data []byte) {
-		var args moveData
-		if err := json.Unmarshal(data, &args); err != nil {
-			return
+		content.Version = version
+		conn.Broadcast(conn.Name, "content", content)
+
+		return content, nil
+	}, requireRetro)
+
+	sock.HandleFunc(mux, "move", func(conn *sock.Conn, args moveData) (struct{}, error) {
+		db := r.db.WithContext(conn.Context())
+
+		if err := firstError(
+			inRetro("cardId", args.CardId, conn.RetroId, db.GetCardRetro),
+			inRetro("columnTo", args.ColumnTo, conn.RetroId, columnRetro(db))); err != nil {
+			return struct{}{}, err
 		}
 
-		r.db.MoveCard(args.CardId, args.ColumnTo)
+		if err := db.MoveCard(args.CardId, args.ColumnTo); err != nil {
+			return struct{}{}, fmt.Errorf("move card %s: %w", args.CardId, err)
+		}
 
 		conn.Broadcast(conn.Name, "move", args)
-	})
 
-	mux.Handle("stage", func(conn *sock.Conn, data []byte) {
-		var args stageData
-		if err := json.Unmarshal(data, &args); err != nil {
-			return
+		return struct{}{}, nil
+	}, requireRetro)
+
+	sock.HandleFunc(mux, "stage", func(conn *sock.Conn, args stageData) (struct{}, error) {
+		db := r.db.WithContext(conn.Context())
+
+		if err := oneOf("stage", args.Stage, "Thinking", "Presenting", "Voting", "Discussing"); err != nil {
+			return struct{}{}, err
 		}
 
-		r.db.SetStage(conn.RetroId, args.Stage)
+		if _, err := db.SetStage(conn.RetroId, args.Stage); err != nil {
+			return struct{}{}, fmt.Errorf("set stage: %w", err)
+		}
 
 		conn.Broadcast(conn.Name, "stage", args)
-	})
 
-	mux.Handle("reveal", func(conn *sock.Conn, data []byte) {
-		var args revealData
-		if err := json.Unmarshal(data, &args); err != nil {
-			return
+		if ready, err := readiness(db, conn.RetroId, args.Stage); err == nil {
+			conn.BroadcastRetro("", "ready", ready)
 		}
 
-		r.db.RevealCard(args.CardId)
+		return struct{}{}, nil
+	}, requireRetro)
 
-		conn.Broadcast(conn.Name, "reveal", args)
-	})
+	sock.HandleFunc(mux, "ready", func(conn *sock.Conn, args struct {
+		Stage string
+		Ready bool
+	}) (readyData, error) {
+		db := r.db.WithContext(conn.Context())
 
-	mux.Handle("group", func(conn *sock.Conn, data []byte) {
-		var args groupData
-		if err := json.Unmarshal(data, &args); err != nil {
-			return
+		retro, err := db.GetRetro(conn.RetroId)
+		if err != nil {
+			return readyData{}, fmt.Errorf("get retro: %w", err)
+		}
+		if args.Stage == "" || args.Stage != retro.Stage {
+			// The stage has moved on since the client sent this.
+			return readyData{}, sock.Error("stale_stage")
+		}
+
+		stage := ""
+		if args.Ready {
+			stage = retro.Stage
+		}
+		if err := db.SetReady(conn.RetroId, conn.Name, stage); err == sql.ErrNoRows {
+			// Joined the retro without being one of its participants.
+			return readyData{}, sock.Error("not_participant")
+		} else if err != nil {
+			return readyData{}, fmt.Errorf("set ready: %w", err)
+		}
+
+		ready, err := readiness(db, conn.RetroId, retro.Stage)
+		if err != nil {
+			return readyData{}, fmt.Errorf("count ready: %w", err)
 		}
 
-		err := r.db.GroupCards(args.CardFrom, args.CardTo)
+		conn.BroadcastRetro("", "ready", ready)
+
+		return ready, nil
+	}, requireRetro)
+
+	sock.HandleFunc(mux, "typing", func(conn *sock.Conn, args typingData) (struct{}, error) {
+		db := r.db.WithContext(conn.Context())
+
+		if err := inRetro("columnId", args.ColumnId, conn.RetroId, columnRetro(db)); err != nil {
+			return struct{}{}, err
+		}
+
+		r.typing.Typing(conn.RetroId, args.ColumnId, conn.Name, args.Typing)
+
+		return struct{}{}, nil
+	}, requireRetro)
+
+	sock.HandleFunc(mux, "closeRetro", func(conn *sock.Conn, args struct{}) (struct{}, error) {
+		db := r.db.WithContext(conn.Context())
+
+		changed, err := db.SetStage(conn.RetroId, "Closed")
 		if err != nil {
-			log.Println(err)
+			return struct{}{}, fmt.Errorf("set stage: %w", err)
+		}
+		if !changed {
+			// Already closed, so the summary has been sent.
+			return struct{}{}, nil
+		}
+
+		conn.Broadcast(conn.Name, "stage", stageData{"Closed"})
+
+		if r.mailer != nil {
+			retroId := conn.RetroId
+			r.background(func() { sendSummary(r.db, r.mailer, retroId) })
+		}
+
+		return struct{}{}, nil
+	}, requireRetro)
+
+	sock.HandleFunc(mux, "reveal", func(conn *sock.Conn, args revealData) (struct{}, error) {
+		db := r.db.WithContext(conn.Context())
+
+		if err := inRetro("cardId", args.CardId, conn.RetroId, db.GetCardRetro); err != nil {
+			return struct{}{}, err
+		}
+
+		if err := db.RevealCard(args.CardId); err != nil {
+			return struct{}{}, fmt.Errorf("reveal card %s: %w", args.CardId, err)
+		}
+
+		conn.Broadcast(conn.Name, "reveal", args)
+
+		return struct{}{}, nil
+	}, requireRetro)
+
+	sock.HandleFunc(mux, "group", func(conn *sock.Conn, args groupData) (struct{}, error) {
+		db := r.db.WithContext(conn.Context())
+
+		if err := firstError(
+			inRetro("cardFrom", args.CardFrom, conn.RetroId, db.GetCardRetro),
+			inRetro("cardTo", args.CardTo, conn.RetroId, db.GetCardRetro)); err != nil {
+			return struct{}{}, err
+		}
+
+		if err := db.GroupCards(args.CardFrom, args.CardTo); err != nil {
+			return struct{}{}, fmt.Errorf("group cards %s and %s: %w", args.CardFrom, args.CardTo, err)
 		}
 
 		conn.Broadcast(conn.Name, "group", args)
-	})
 
-	mux.Handle("vote", func(conn *sock.Conn, data []byte) {
-		var args voteData
-		if err := json.Unmarshal(data, &args); err != nil {
-			return
+		return struct{}{}, nil
+	}, requireRetro)
+
+	sock.HandleFunc(mux, "vote", func(conn *sock.Conn, args voteData) (struct{}, error) {
+		db := r.db.WithContext(conn.Context())
+
+		if err := inRetro("cardId", args.CardId, conn.RetroId, db.GetCardRetro); err != nil {
+			return struct{}{}, err
 		}
 
 		args.UserId = conn.Name
-		r.db.Vote(conn.Name, args.CardId)
+		if err := db.Vote(conn.Name, args.CardId); err != nil {
+			return struct{}{}, fmt.Errorf("vote %s: %w", args.CardId, err)
+		}
 
 		conn.Broadcast(conn.Name, "vote", args)
-	})
 
-	mux.Handle("unvote", func(conn *sock.Conn, data []byte) {
-		var args voteData
-		if err := json.Unmarshal(data, &args); err != nil {
-			return
+		return struct{}{}, nil
+	}, requireRetro)
+
+	sock.HandleFunc(mux, "unvote", func(conn *sock.Conn, args voteData) (struct{}, error) {
+		db := r.db.WithContext(conn.Context())
+
+		if err := inRetro("cardId", args.CardId, conn.RetroId, db.GetCardRetro); err != nil {
+			return struct{}{}, err
 		}
 
 		args.UserId = conn.Name
-		r.db.Unvote(conn.Name, args.CardId)
+		if err := db.Unvote(conn.Name, args.CardId); err != nil {
+			return struct{}{}, fmt.Errorf("unvote %s: %w", args.CardId, err)
+		}
 
 		conn.Broadcast(conn.Name, "unvote", args)
-	})
 
-	mux.Handle("delete", func(conn *sock.Conn, data []byte) {
-		var args deleteData
-		if err := json.Unmarshal(data, &args); err != nil {
-			return
+		return struct{}{}, nil
+	}, requireRetro)
+
+	sock.HandleFunc(mux, "delete", func(conn *sock.Conn, args deleteData) (struct{}, error) {
+		db := r.db.WithContext(conn.Context())
+
+		if err := inRetro("cardId", args.CardId, conn.RetroId, db.GetCardRetro); err != nil {
+			return struct{}{}, err
 		}
 
-		r.db.DeleteCard(args.CardId)
+		if err := db.DeleteCard(args.CardId); err != nil {
+			return struct{}{}, fmt.Errorf("delete card %s: %w", args.CardId, err)
+		}
 
 		conn.Broadcast(conn.Name, "delete", args)
-	})
 
-	mux.Handle("createRetro", func(conn *sock.Conn, data []byte) {
-		var args struct {
-			Name  string   `json:"name"`
-			Users []string `json:"users"`
+		return struct{}{}, nil
+	}, requireRetro)
+
+	sock.HandleFunc(mux, "addAction", func(conn *sock.Conn, args struct {
+		Text  string    `json:"text"`
+		Owner string    `json:"owner"`
+		DueAt time.Time `json:"dueAt"`
+	}) (actionData, error) {
+		db := r.db.WithContext(conn.Context())
+
+		if err := firstError(
+			r.limits.text("text", args.Text),
+			r.limits.optionalName("owner", args.Owner)); err != nil {
+			return actionData{}, err
 		}
 
-		if err := json.Unmarshal(data, &args); err != nil {
-			log.Println(err)
-			return
+		action := database.Action{
+			Id:    strId(),
+			Retro: conn.RetroId,
+			Text:  args.Text,
+			Owner: args.Owner,
+			DueAt: args.DueAt,
 		}
 
-		retroId := strId()
-		createdAt := time.Now()
+		if r.tracker != nil {
+			ref, err := r.tracker.Create(conn.Context(), actionIssue(db, action))
+			if err != nil {
+				// syncActions will try again later.
+				conn.Log().Error("create issue", "err", err)
+				action.IssuePending = true
+			} else {
+				action.IssueKey = ref.Key
+				action.IssueURL = ref.URL
+			}
+		}
+
+		if err := db.AddAction(action); err != nil {
+			return actionData{}, fmt.Errorf("add action: %w", err)
+		}
+
+		added := actionData{action.Id, action.Text, action.Owner, action.DueAt, action.Closed, action.IssueKey, action.IssueURL}
+		conn.Broadcast("", "action", added)
+
+		return added, nil
+	}, requireRetro)
 
-		r.db.AddRetro(database.Retro{
-			Id:        retroId,
+	sock.HandleFunc(mux, "createRetro", func(conn *sock.Conn, args struct {
+		Name  string   `json:"name"`
+		Users []string `json:"users"`
+	}) (retroData, error) {
+		db := r.db.WithContext(conn.Context())
+
+		if err := firstError(
+			r.limits.name("name", args.Name),
+			r.limits.users(db, "users", args.Users)); err != nil {
+			return retroData{}, err
+		}
+
+		allParticipants := withUser(args.Users, conn.Name)
+
+		retro := database.Retro{
+			Id:        strId(),
 			Name:      args.Name,
-			Stage:     "",
-			CreatedAt: createdAt,
-		})
+			CreatedAt: time.Now(),
+		}
 
-		r.db.AddColumn(database.Column{
-			Id:    strId(),
-			Retro: retroId,
-			Name:  "Start",
-			Order: 0,
-		})
+		if err := addRetro(db, retro, defaultColumns, allParticipants); err != nil {
+			return retroData{}, fmt.Errorf("add retro: %w", err)
+		}
 
-		r.db.AddColumn(database.Column{
-			Id:    strId(),
-			Retro: retroId,
-			Name:  "More",
-			Order: 1,
-		})
+		created := retroData{retro.Id, retro.Name, retro.CreatedAt, allParticipants}
+		conn.Send(conn.Name, "retro", created)
 
-		r.db.AddColumn(database.Column{
-			Id:    strId(),
-			Retro: retroId,
-			Name:  "Keep",
-			Order: 2,
-		})
+		return created, nil
+	})
 
-		r.db.AddColumn(database.Column{
-			Id:    strId(),
-			Retro: retroId,
-			Name:  "Less",
-			Order: 3,
-		})
+	sock.HandleFunc(mux, "createTeam", func(conn *sock.Conn, args struct {
+		Name          string    `json:"name"`
+		Users         []string  `json:"users"`
+		Columns       []string  `json:"columns"`
+		EveryWeeks    int       `json:"everyWeeks"`
+		StartAt       time.Time `json:"startAt"`
+		LengthMinutes int       `json:"lengthMinutes"`
+		RetentionDays int       `json:"retentionDays"`
+	}) (teamData, error) {
+		db := r.db.WithContext(conn.Context())
+
+		if err := firstError(
+			r.limits.name("name", args.Name),
+			r.limits.users(db, "users", args.Users),
+			r.limits.names("columns", args.Columns),
+			atLeast("everyWeeks", args.EveryWeeks, 0),
+			atLeast("lengthMinutes", args.LengthMinutes, 0),
+			atLeast("retentionDays", args.RetentionDays, 0)); err != nil {
+			return teamData{}, err
+		}
+		if args.EveryWeeks > 0 && args.StartAt.IsZero() {
+			// The schedule counts on from the first retro.
+			return teamData{}, &fieldError{Field: "startAt", Reason: "required"}
+		}
 
-		r.db.AddColumn(database.Column{
-			Id:    strId(),
-			Retro: retroId,
-			Name:  "Stop",
-			Order: 4,
-		})
+		team := database.Team{
+			Id:            strId(),
+			Name:          args.Name,
+			Columns:       args.Columns,
+			EveryWeeks:    args.EveryWeeks,
+			NextAt:        args.StartAt,
+			Length:        time.Duration(args.LengthMinutes) * time.Minute,
+			RetentionDays: args.RetentionDays,
+		}
+		if len(team.Columns) == 0 {
+			team.Columns = defaultColumns
+		}
+		if team.Length <= 0 {
+			team.Length = time.Hour
+		}
 
-		allParticipants := append(args.Users, conn.Name)
+		members := withUser(args.Users, conn.Name)
 
-		for _, user := range allParticipants {
-			r.db.AddParticipant(retroId, user)
+		if err := db.AddTeam(team, members); err != nil {
+			return teamData{}, fmt.Errorf("add team: %w", err)
 		}
 
-		conn.Send(conn.Name, "retro", retroData{retroId, args.Name, createdAt, allParticipants})
+		created := teamData{team.Id, team.Name, members, team.EveryWeeks, team.NextAt, calendarPath(team.Id)}
+		conn.Send(conn.Name, "team", created)
+
+		return created, nil
 	})
 }
 
+// readiness counts the participants that are done with the retro's stage. Only
+// the counts are shared, not who is ready.
+func readiness(db *database.Database, retroId, stage string) (readyData, error) {
+	ready, total, err := db.CountReady(retroId, stage)
+	if err != nil {
+		return readyData{}, err
+	}
+
+	return readyData{Stage: stage, Ready: ready, Total: total}, nil
+}
+
+var defaultColumns = []string{"Start", "More", "Keep", "Less", "Stop"}
+
+// addRetro creates the retro along with its columns and participants.
+func addRetro(db *database.Database, retro database.Retro, columns, participants []string) error {
+	cols := make([]database.Column, len(columns))
+	for i, name := range columns {
+		cols[i] = database.Column{
+			Id:    strId(),
+			Retro: retro.Id,
+			Name:  name,
+			Order: i,
+		}
+	}
+
+	return db.AddRetro(retro, cols, participants)
+}
+
+// withUser returns users with name added, and without any repeated names.
+func withUser(users []string, name string) []string {
+	seen := map[string]bool{}
+	var all []string
+	for _, user := range append(users, name) {
+		if !seen[user] {
+			seen[user] = true
+			all = append(all, user)
+		}
+	}
+
+	return all
+}
+
+// scheduleRetros periodically creates the retros for each team with a
+// schedule, lead ahead of the time they are due to be held.
+func scheduleRetros(ctx context.Context, db *database.Database, every, lead time.Duration) {
+	for range ticks(ctx, every) {
+		teams, err := db.GetScheduledTeams()
+		if err != nil {
+			slog.Error("schedule: get teams", "err", err)
+			continue
+		}
+
+		for _, team := range teams {
+			if team.NextAt.IsZero() {
+				continue
+			}
+
+			members, err := db.GetMembers(team.Id)
+			if err != nil {
+				slog.Error("schedule: get members", "teamId", team.Id, "err", err)
+				continue
+			}
+
+			// skip any retros that were missed while the server was down
+			for team.NextAt.Before(time.Now()) {
+				team.NextAt = team.NextAt.AddDate(0, 0, 7*team.EveryWeeks)
+			}
+
+			for !team.NextAt.After(time.Now().Add(lead)) {
+				retro := database.Retro{
+					Id:          strId(),
+					Name:        team.Name + " " + team.NextAt.Format("2 Jan 2006"),
+					CreatedAt:   time.Now(),
+					Team:        team.Id,
+					ScheduledAt: team.NextAt,
+				}
+
+				if err := addRetro(db, retro, team.Columns, members); err != nil {
+					slog.Error("schedule: add retro", "teamId", team.Id, "err", err)
+					break
+				}
+
+				team.NextAt = team.NextAt.AddDate(0, 0, 7*team.EveryWeeks)
+				if err := db.SetTeamNextAt(team.Id, team.NextAt); err != nil {
+					slog.Error("schedule: set next", "teamId", team.Id, "err", err)
+					break
+				}
+			}
+		}
+	}
+}
+
+func calendarPath(teamId string) string {
+	return "/calendar/" + teamId + ".ics"
+}
+
+// serveCalendar serves an iCalendar feed for each team at the path given by
+// calendarPath. The feed contains the retros already created for the team, and
+// the next few that are planned.
+func serveCalendar(db *database.Database) http.HandlerFunc {
+	const planned = 10
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		teamId := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/calendar/"), ".ics")
+
+		team, err := db.GetTeam(teamId)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		retros, err := db.GetTeamRetros(teamId)
+		if err != nil {
+			slog.Error("calendar: get retros", "teamId", teamId, "err", err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+
+		scheme := "http"
+		if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+			scheme = "https"
+		}
+
+		var events []calendar.Event
+		for _, retro := range retros {
+			events = append(events, calendar.Event{
+				UID:     team.Id + "-" + strconv.FormatInt(retro.ScheduledAt.Unix(), 10) + "@retro",
+				Summary: retro.Name,
+				Start:   retro.ScheduledAt,
+				End:     retro.ScheduledAt.Add(team.Length),
+				URL:     scheme + "://" + r.Host + "/#/" + retro.Id,
+			})
+		}
+
+		if team.EveryWeeks > 0 && !team.NextAt.IsZero() {
+			at := team.NextAt
+			for i := 0; i < planned; i++ {
+				events = append(events, calendar.Event{
+					UID:     team.Id + "-" + strconv.FormatInt(at.Unix(), 10) + "@retro",
+					Summary: team.Name + " " + at.Format("2 Jan 2006"),
+					Start:   at,
+					End:     at.Add(team.Length),
+				})
+				at = at.AddDate(0, 0, 7*team.EveryWeeks)
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+		if err := calendar.Write(w, team.Name, events); err != nil {
+			slog.Error("calendar: write", "teamId", teamId, "err", err)
+		}
+	}
+}
+
+// actionIssue describes the issue to create in a tracker for the action.
+func actionIssue(db *database.Database, action database.Action) tracker.Issue {
+	body := "An action from the retro"
+	if retro, err := db.GetRetro(action.Retro); err == nil {
+		body += " \"" + retro.Name + "\""
+	}
+	body += "."
+
+	if action.Owner != "" {
+		body += "\n\nOwner: " + action.Owner
+	}
+	if !action.DueAt.IsZero() {
+		body += "\n\nDue: " + action.DueAt.Format("2006-01-02")
+	}
+
+	return tracker.Issue{
+		Title: action.Text,
+		Body:  body,
+	}
+}
+
+// syncActions periodically creates the issues that failed to be created when
+// their action was added, then checks each action linked to an issue, and
+// marks it closed or reopened to match the tracker.
+func syncActions(ctx context.Context, db *database.Database, t tracker.Tracker, every time.Duration) {
+	for range ticks(ctx, every) {
+		pending, err := db.GetPendingActions()
+		if err != nil {
+			slog.Error("sync actions: get pending actions", "err", err)
+		}
+
+		for _, action := range pending {
+			ref, err := t.Create(ctx, actionIssue(db, action))
+			if err != nil {
+				slog.Error("sync actions: create issue", "actionId", action.Id, "err", err)
+				continue
+			}
+
+			if err := db.LinkAction(action.Id, ref.Key, ref.URL); err != nil {
+				slog.Error("sync actions: link action", "actionId", action.Id, "err", err)
+			}
+		}
+
+		actions, err := db.GetLinkedActions()
+		if err != nil {
+			slog.Error("sync actions: get actions", "err", err)
+			continue
+		}
+
+		for _, action := range actions {
+			closed, err := t.Closed(ctx, action.IssueKey)
+			if err != nil {
+				slog.Error("sync actions: check issue", "issueKey", action.IssueKey, "err", err)
+				continue
+			}
+
+			if closed != action.Closed {
+				if err := db.SetActionClosed(action.Id, closed); err != nil {
+					slog.Error("sync actions: set closed", "actionId", action.Id, "err", err)
+				}
+			}
+		}
+	}
+}
+
+// sendSummary emails each participant of the retro with an email address a
+// summary of the cards and actions.
+func sendSummary(db *database.Database, mailer *mail.Mailer, retroId string) {
+	retro, err := db.GetRetro(retroId)
+	if err != nil {
+		slog.Error("summary: get retro", "retroId", retroId, "err", err)
+		return
+	}
+
+	summary := mail.Summary{Retro: retro.Name, Date: retro.CreatedAt}
+
+	columns, err := db.GetColumns(retroId)
+	if err != nil {
+		slog.Error("summary: get columns", "retroId", retroId, "err", err)
+		return
+	}
+	for _, column := range columns {
+		summaryColumn := mail.Column{Name: column.Name}
+
+		cards, err := db.GetCards("", column.Id)
+		if err != nil {
+			slog.Error("summary: get cards", "retroId", retroId, "err", err)
+			return
+		}
+		for _, card := range cards {
+			summaryCard := mail.Card{Votes: card.TotalVotes}
+
+			contents, err := db.GetContents(card.Id)
+			if err != nil {
+				slog.Error("summary: get contents", "retroId", retroId, "err", err)
+				return
+			}
+			for _, content := range contents {
+				summaryCard.Texts = append(summaryCard.Texts, content.Text)
+			}
+
+			summaryColumn.Cards = append(summaryColumn.Cards, summaryCard)
+		}
+
+		summary.Columns = append(summary.Columns, summaryColumn)
+	}
+
+	actions, err := db.GetActions(retroId)
+	if err != nil {
+		slog.Error("summary: get actions", "retroId", retroId, "err", err)
+		return
+	}
+	for _, action := range actions {
+		summary.Actions = append(summary.Actions, mailAction(retro.Name, action))
+	}
+
+	participants, err := db.GetParticipants(retroId)
+	if err != nil {
+		slog.Error("summary: get participants", "retroId", retroId, "err", err)
+		return
+	}
+
+	var to []string
+	for _, participant := range participants {
+		if user, err := db.GetUser(participant); err == nil && user.Email != "" {
+			to = append(to, user.Email)
+		}
+	}
+
+	if err := mailer.SendSummary(to, summary); err != nil {
+		slog.Error("summary: send", "retroId", retroId, "err", err)
+	}
+}
+
+func mailAction(retroName string, action database.Action) mail.Action {
+	return mail.Action{
+		Retro: retroName,
+		Text:  action.Text,
+		Owner: action.Owner,
+		DueAt: action.DueAt,
+		URL:   action.IssueURL,
+	}
+}
+
+// remindActions periodically emails the owners of actions that will be due
+// within the given duration. Each action is only reminded about once.
+func remindActions(ctx context.Context, db *database.Database, mailer *mail.Mailer, every, before time.Duration) {
+	for range ticks(ctx, every) {
+		actions, err := db.GetActionsDueBefore(time.Now().Add(before))
+		if err != nil {
+			slog.Error("remind: get actions", "err", err)
+			continue
+		}
+
+		for _, action := range actions {
+			user, err := db.GetUser(action.Owner)
+			if err != nil || user.Email == "" {
+				continue
+			}
+
+			var retroName string
+			if retro, err := db.GetRetro(action.Retro); err == nil {
+				retroName = retro.Name
+			}
+
+			if err := mailer.SendReminder(user.Email, mail.Reminder{Action: mailAction(retroName, action)}); err != nil {
+				slog.Error("remind: send", "actionId", action.Id, "err", err)
+				continue
+			}
+
+			if err := db.SetActionReminded(action.Id, time.Now()); err != nil {
+				slog.Error("remind: set reminded", "actionId", action.Id, "err", err)
+			}
+		}
+	}
+}
+
 type config struct {
-	GitHub    gitHubConfig    `toml:"github"`
-	Office365 office365Config `toml:"office365"`
+	GitHub     gitHubConfig     `toml:"github"`
+	Office365  office365Config  `toml:"office365"`
+	Tracker    trackerConfig    `toml:"tracker"`
+	Mail       mailConfig       `toml:"mail"`
+	Schedule   scheduleConfig   `toml:"schedule"`
+	Backup     backupConfig     `toml:"backup"`
+	Retention  retentionConfig  `toml:"retention"`
+	Encryption encryptionConfig `toml:"encryption"`
+	Tracing    tracingConfig    `toml:"tracing"`
+	Sock       sockConfig       `toml:"sock"`
+	Broker     brokerConfig     `toml:"broker"`
+	Limits     limitsConfig     `toml:"limits"`
 }
 
 type gitHubConfig struct {
@@ -426,30 +1114,452 @@ type office365Config struct {
 	Domain       string `toml:"domain"`
 }
 
+type trackerConfig struct {
+	// Kind is either "github" or "jira", if empty no issues will be created.
+	Kind      string `toml:"kind"`
+	URL       string `toml:"url"`
+	Username  string `toml:"username"`
+	Token     string `toml:"token"`
+	Project   string `toml:"project"`
+	IssueType string `toml:"issueType"`
+	Interval  string `toml:"syncInterval"`
+
+	// Timeout bounds each request to the tracker, it defaults to 10s.
+	Timeout string `toml:"timeout"`
+}
+
+func (c trackerConfig) tracker() (tracker.Tracker, error) {
+	if c.Kind == "" {
+		return nil, nil
+	}
+
+	timeout := 10 * time.Second
+	if c.Timeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(c.Timeout); err != nil {
+			return nil, err
+		}
+	}
+	client := &http.Client{Timeout: timeout}
+
+	switch c.Kind {
+	case "github":
+		return &tracker.GitHub{BaseURL: c.URL, Token: c.Token, Repository: c.Project, Client: client}, nil
+	case "jira":
+		return &tracker.Jira{BaseURL: c.URL, Username: c.Username, Token: c.Token, Project: c.Project, IssueType: c.IssueType, Client: client}, nil
+	default:
+		return nil, errors.New("unknown tracker kind: " + c.Kind)
+	}
+}
+
+func (c trackerConfig) interval() (time.Duration, error) {
+	if c.Interval == "" {
+		return 10 * time.Minute, nil
+	}
+
+	return time.ParseDuration(c.Interval)
+}
+
+type mailConfig struct {
+	// Addr is the "host:port" of the SMTP server, if empty no mail is sent.
+	Addr             string `toml:"addr"`
+	Username         string `toml:"username"`
+	Password         string `toml:"password"`
+	From             string `toml:"from"`
+	SummaryTemplate  string `toml:"summaryTemplate"`
+	ReminderTemplate string `toml:"reminderTemplate"`
+	RemindBefore     string `toml:"remindBefore"`
+}
+
+func (c mailConfig) mailer() (*mail.Mailer, error) {
+	if c.Addr == "" {
+		return nil, nil
+	}
+
+	return mail.New(c.Addr, c.Username, c.Password, c.From, c.SummaryTemplate, c.ReminderTemplate)
+}
+
+func (c mailConfig) remindBefore() (time.Duration, error) {
+	if c.RemindBefore == "" {
+		return 48 * time.Hour, nil
+	}
+
+	return time.ParseDuration(c.RemindBefore)
+}
+
+type scheduleConfig struct {
+	// Lead is how far ahead of the scheduled time retros are created.
+	Lead string `toml:"lead"`
+}
+
+func (c scheduleConfig) lead() (time.Duration, error) {
+	if c.Lead == "" {
+		return 24 * time.Hour, nil
+	}
+
+	return time.ParseDuration(c.Lead)
+}
+
+type backupConfig struct {
+	// Dir is where snapshots are written, if empty no snapshots are taken.
+	Dir   string `toml:"dir"`
+	Every string `toml:"every"`
+	Keep  int    `toml:"keep"`
+}
+
+func (c backupConfig) every() (time.Duration, error) {
+	if c.Every == "" {
+		return 24 * time.Hour, nil
+	}
+
+	return time.ParseDuration(c.Every)
+}
+
+// backupDatabase periodically takes a snapshot of the database into dir,
+// keeping only the latest keep.
+func backupDatabase(ctx context.Context, db *database.Database, dir string, every time.Duration, keep int) {
+	for range ticks(ctx, every) {
+		path, err := db.Snapshot(dir, keep)
+		if err != nil {
+			slog.Error("backup", "err", err)
+			continue
+		}
+
+		slog.Info("backup written", "path", path)
+	}
+}
+
+type encryptionConfig struct {
+	// Key is a base64 encoded 32 byte key used to encrypt card and action text,
+	// it can also be given by setting RETRO_KEY. If empty text is not
+	// encrypted.
+	Key string `toml:"key"`
+}
+
+func (c encryptionConfig) key() ([]byte, error) {
+	key := os.Getenv("RETRO_KEY")
+	if key == "" {
+		key = c.Key
+	}
+	if key == "" {
+		return nil, nil
+	}
+
+	return base64.StdEncoding.DecodeString(key)
+}
+
+// openDatabase opens the database at path, setting the encryption key if one
+// is configured.
+func openDatabase(path string, conf config) (*database.Database, error) {
+	key, err := conf.Encryption.key()
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := database.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = db.SetKey(key); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+type sockConfig struct {
+	// QueueSize is the number of messages that can be waiting to be sent to a
+	// connection.
+	QueueSize int `toml:"queueSize"`
+
+	// SlowConsumer is what happens when a connection's queue is full, either
+	// "drop" to discard the message, or "disconnect".
+	SlowConsumer string `toml:"slowConsumer"`
+
+	// PingInterval is how often connections are pinged, and PingTimeout is how
+	// long one can be silent before it is dropped.
+	PingInterval string `toml:"pingInterval"`
+	PingTimeout  string `toml:"pingTimeout"`
+
+	// Limits sets rate limits for ops by name, or "default" for every op
+	// without its own.
+	Limits map[string]limitConfig `toml:"limits"`
+}
+
+type limitConfig struct {
+	// ConnRate is the messages per second allowed on a connection, in bursts of
+	// up to ConnBurst. UserRate and UserBurst are the same for each user across
+	// their connections. A rate of 0 is unlimited.
+	ConnRate  float64 `toml:"connRate"`
+	ConnBurst int     `toml:"connBurst"`
+	UserRate  float64 `toml:"userRate"`
+	UserBurst int     `toml:"userBurst"`
+}
+
+func (c sockConfig) apply(server *sock.Server) error {
+	size := c.QueueSize
+	if size <= 0 {
+		size = 256
+	}
+
+	switch c.SlowConsumer {
+	case "", "drop":
+		server.SendQueue(size, sock.Drop)
+	case "disconnect":
+		server.SendQueue(size, sock.Disconnect)
+	default:
+		return errors.New("unknown slowConsumer policy: " + c.SlowConsumer)
+	}
+
+	interval, timeout := 30*time.Second, 75*time.Second
+	if c.PingInterval != "" {
+		d, err := time.ParseDuration(c.PingInterval)
+		if err != nil {
+			return err
+		}
+		interval = d
+	}
+	if c.PingTimeout != "" {
+		d, err := time.ParseDuration(c.PingTimeout)
+		if err != nil {
+			return err
+		}
+		timeout = d
+	}
+	if timeout <= interval {
+		return errors.New("sock pingTimeout must be longer than pingInterval")
+	}
+	server.Keepalive(interval, timeout)
+
+	for op, limit := range c.Limits {
+		if op == "default" {
+			op = ""
+		}
+		server.RateLimit(op,
+			sock.Limit{Rate: limit.ConnRate, Burst: limit.ConnBurst},
+			sock.Limit{Rate: limit.UserRate, Burst: limit.UserBurst})
+	}
+
+	return nil
+}
+
+type tracingConfig struct {
+	// Endpoint is the "host:port" of an OTLP/HTTP collector to send spans to, if
+	// empty spans are not recorded.
+	Endpoint string `toml:"endpoint"`
+	Insecure bool   `toml:"insecure"`
+}
+
+type limitsConfig struct {
+	// MaxMessageBytes is the largest websocket message a client can send.
+	MaxMessageBytes int `toml:"maxMessageBytes"`
+
+	// MaxTextLength is the most characters in a card or action, MaxNameLength
+	// in a name or id, and MaxListLength is the most entries in a list such as
+	// the users to add to a retro.
+	MaxTextLength int `toml:"maxTextLength"`
+	MaxNameLength int `toml:"maxNameLength"`
+	MaxListLength int `toml:"maxListLength"`
+}
+
+func (c limitsConfig) apply(room *Room) {
+	if c.MaxMessageBytes > 0 {
+		room.server.MaxMessageSize(c.MaxMessageBytes)
+	}
+	if c.MaxTextLength > 0 {
+		room.limits.TextLength = c.MaxTextLength
+	}
+	if c.MaxNameLength > 0 {
+		room.limits.NameLength = c.MaxNameLength
+	}
+	if c.MaxListLength > 0 {
+		room.limits.ListLength = c.MaxListLength
+	}
+}
+
+type brokerConfig struct {
+	// Kind is "redis" to share broadcasts with other instances, if empty they
+	// only reach connections to this one.
+	Kind     string `toml:"kind"`
+	Addr     string `toml:"addr"`
+	Password string `toml:"password"`
+	Channel  string `toml:"channel"`
+}
+
+func (c brokerConfig) broker() (sock.Broker, error) {
+	switch c.Kind {
+	case "":
+		return nil, nil
+	case "redis":
+		channel := c.Channel
+		if channel == "" {
+			channel = "retro"
+		}
+		return sock.NewRedisBroker(c.Addr, c.Password, channel), nil
+	default:
+		return nil, errors.New("unknown broker kind: " + c.Kind)
+	}
+}
+
+// setupTracing sets the global tracer provider to export spans to the
+// configured collector. The returned function flushes any remaining spans.
+func setupTracing(conf tracingConfig) (func(context.Context) error, error) {
+	if conf.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(conf.Endpoint)}
+	if conf.Insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", "retro"))))
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
 func main() {
+	if err := run(); err != nil {
+		slog.Error("fatal", "err", err)
+		os.Exit(1)
+	}
+}
+
+// run starts the server, or carries out a command, returning once it is done
+// so that everything opened can be closed.
+func run() error {
 	var (
 		configPath = flag.String("config", "config.toml", "")
 		port       = flag.String("port", "8080", "")
 		socket     = flag.String("socket", "", "")
 		assets     = flag.String("assets", "app/dist", "")
 		dbPath     = flag.String("db", "./db", "")
+		logLevel   = flag.String("log-level", "info", "")
 	)
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, commandUsage)
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
-	db, err := database.Open(*dbPath)
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(*logLevel)); err != nil {
+		return err
+	}
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+
+	conf := config{}
+	if _, err := toml.DecodeFile(*configPath, &conf); err != nil {
+		// commands can be run without a config file
+		if flag.NArg() == 0 || !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if flag.NArg() > 0 {
+		return runCommand(*dbPath, conf, flag.Args())
+	}
+
+	shutdownTracing, err := setupTracing(conf.Tracing)
+	if err != nil {
+		return err
+	}
+	defer shutdownTracing(context.Background())
+
+	db, err := openDatabase(*dbPath, conf)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 	defer db.Close()
 
 	room := NewRoom(db)
 
-	conf := config{}
-	if _, err := toml.DecodeFile(*configPath, &conf); err != nil {
-		log.Fatal(err)
+	// Background tasks are stopped, and waited for, before the database is
+	// closed.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer room.tasks.Wait()
+	defer cancel()
+	if err := conf.Sock.apply(room.server); err != nil {
+		return err
 	}
+	conf.Limits.apply(room)
+
+	broker, err := conf.Broker.broker()
+	if err != nil {
+		return err
+	}
+	if broker != nil {
+		if err := room.server.Broker(broker); err != nil {
+			return err
+		}
+		defer broker.Close()
+	}
+
+	room.tracker, err = conf.Tracker.tracker()
+	if err != nil {
+		return err
+	}
+	if room.tracker != nil {
+		interval, err := conf.Tracker.interval()
+		if err != nil {
+			return err
+		}
+		room.background(func() { syncActions(ctx, db, room.tracker, interval) })
+	}
+
+	room.mailer, err = conf.Mail.mailer()
+	if err != nil {
+		return err
+	}
+	if room.mailer != nil {
+		before, err := conf.Mail.remindBefore()
+		if err != nil {
+			return err
+		}
+		room.background(func() { remindActions(ctx, db, room.mailer, time.Hour, before) })
+	}
+
+	lead, err := conf.Schedule.lead()
+	if err != nil {
+		return err
+	}
+	room.background(func() { scheduleRetros(ctx, db, 5*time.Minute, lead) })
+
+	if conf.Backup.Dir != "" {
+		every, err := conf.Backup.every()
+		if err != nil {
+			return err
+		}
+		room.background(func() { backupDatabase(ctx, db, conf.Backup.Dir, every, conf.Backup.Keep) })
+	}
+
+	room.background(func() { purgeRetros(ctx, db, conf.Retention, time.Hour) })
+
+	prometheus.MustRegister(room.server)
 
 	http.Handle("/", http.FileServer(http.Dir(*assets)))
+	http.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok\n")
+	})
+	http.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if err := db.Ping(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, "ok\n")
+	})
+	http.Handle("/metrics", promhttp.Handler())
+	http.Handle("/calendar/", serveCalendar(db))
 	http.Handle("/ws", room.server)
 
 	gitHubLogin, gitHubCallback := auth.GitHub(room.AddUser, conf.GitHub.ClientID, conf.GitHub.ClientSecret, conf.GitHub.Organisation)
@@ -460,5 +1570,51 @@ func main() {
 	http.Handle("/oauth/office365/login", officeLogin)
 	http.Handle("/oauth/office365/callback", officeCallback)
 
-	serve.Serve(*port, *socket, http.DefaultServeMux)
+	return serveUntilSignal(*port, *socket, room.server)
+}
+
+// serveUntilSignal serves http.DefaultServeMux on the port, or the unix socket
+// if given, until SIGINT or SIGTERM is received. Websocket clients are then
+// told to reconnect and given time for their in-flight ops to finish, before
+// the HTTP server is shut down.
+func serveUntilSignal(port, socket string, sockServer *sock.Server) error {
+	var (
+		l   net.Listener
+		err error
+	)
+	if socket != "" {
+		l, err = net.Listen("unix", socket)
+	} else {
+		l, err = net.Listen("tcp", ":"+port)
+	}
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	srv := &http.Server{Handler: http.DefaultServeMux}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.Serve(l)
+	}()
+	slog.Info("listening", "addr", l.Addr().String())
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+	stop()
+
+	slog.Info("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := sockServer.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("shutdown websockets", "err", err)
+	}
+
+	return srv.Shutdown(shutdownCtx)
 }
@@ -0,0 +1,100 @@
+package sock
+
+import (
+	"context"
+	"sync"
+)
+
+// Envelope is a broadcast as it is passed between servers by a Broker.
+type Envelope struct {
+	// Retro is the retro whose connections should be sent Msg, unless All is
+	// set in which case it goes to every connection.
+	Retro string `json:"retro"`
+	All   bool   `json:"all,omitempty"`
+	Msg   Msg    `json:"msg"`
+
+	// Presence is set, instead of Msg, when a user's first connection to Retro
+	// on a server joins or their last leaves.
+	Presence *Presence `json:"presence,omitempty"`
+
+	// Heartbeat is set, instead of Msg, when a server reports everyone
+	// connected through it.
+	Heartbeat *Heartbeat `json:"heartbeat,omitempty"`
+}
+
+// Presence is a change in whether a user is connected to a retro through a
+// particular server. Seq counts the changes published by the server, so that
+// those arriving out of order can be ignored.
+type Presence struct {
+	Instance string `json:"instance"`
+	Seq      uint64 `json:"seq"`
+	Username string `json:"username"`
+	Joined   bool   `json:"joined"`
+}
+
+// Heartbeat is published regularly by each server sharing a broker, listing
+// the users connected through it to each retro as of the Presence with Seq. A
+// server that hasn't been heard from for a while is treated as gone, along with
+// its users.
+type Heartbeat struct {
+	Instance string              `json:"instance"`
+	Seq      uint64              `json:"seq"`
+	Retros   map[string][]string `json:"retros"`
+
+	// Request asks the other servers to publish their heartbeat straight away,
+	// so that a server that has just subscribed can learn who is connected.
+	Request bool `json:"request,omitempty"`
+}
+
+// A Broker carries broadcasts to every server subscribed to it, so that
+// connections in the same retro receive them whichever server they are
+// connected to.
+type Broker interface {
+	// Publish sends env to every subscribed server, including this one.
+	Publish(ctx context.Context, env Envelope) error
+
+	// Subscribe arranges for deliver to be called with every envelope
+	// published, in order, until the Broker is closed.
+	Subscribe(deliver func(Envelope)) error
+
+	Close() error
+}
+
+// MemoryBroker passes broadcasts between servers in the same process. Each
+// Server uses its own by default, sharing one between servers lets them see
+// each other's broadcasts without running a real broker.
+type MemoryBroker struct {
+	mu          sync.RWMutex
+	subscribers []func(Envelope)
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{}
+}
+
+func (b *MemoryBroker) Publish(ctx context.Context, env Envelope) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, deliver := range b.subscribers {
+		deliver(env)
+	}
+
+	return nil
+}
+
+func (b *MemoryBroker) Subscribe(deliver func(Envelope)) error {
+	b.mu.Lock()
+	b.subscribers = append(b.subscribers, deliver)
+	b.mu.Unlock()
+
+	return nil
+}
+
+func (b *MemoryBroker) Close() error {
+	b.mu.Lock()
+	b.subscribers = nil
+	b.mu.Unlock()
+
+	return nil
+}
@@ -1,45 +1,146 @@
 package sock
 
 import (
-	"encoding/json"
+	"context"
+	"log/slog"
+	"sync"
 
-	"golang.org/x/net/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
 )
 
 type Conn struct {
+	// Id identifies the connection in logs.
+	Id      string
 	Name    string
 	Err     error
 	RetroId string
 	hub     *hub
-	ws      *websocket.Conn
+
+	// transport carries messages to and from the client, using the version of
+	// the protocol it connected with.
+	transport transport
+	protocol  int
+
+	// op is the name of the operation currently being handled, ref is the Ref
+	// of its message, and ctx holds its span.
+	op  string
+	ref string
+	ctx context.Context
+
+	// out holds messages waiting to be written by writeLoop, until done is
+	// closed. written is closed once writeLoop has finished.
+	out       chan Msg
+	done      chan struct{}
+	written   chan struct{}
+	closeOnce sync.Once
+
+	// limiters holds the connection's rate limit bucket for each op.
+	limiters map[string]*rate.Limiter
 }
 
-func (c *Conn) send(msg Msg) error {
-	return websocket.JSON.Send(c.ws, msg)
+// Context returns the context for the operation currently being handled. It
+// should be passed to anything the handler calls that is traced.
+func (c *Conn) Context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+// Op returns the name of the op currently being handled.
+func (c *Conn) Op() string {
+	return c.op
 }
 
+// Log returns a logger annotated with the connection's id, user, retro and the
+// op being handled, along with the trace id when there is one.
+func (c *Conn) Log() *slog.Logger {
+	logger := slog.With(
+		"connId", c.Id,
+		"username", c.Name,
+		"retroId", c.RetroId,
+		"op", c.op)
+
+	if sc := trace.SpanFromContext(c.Context()).SpanContext(); sc.IsValid() {
+		logger = logger.With("traceId", sc.TraceID().String(), "spanId", sc.SpanID().String())
+	}
+
+	return logger
+}
+
+// Join sets the retro that the connection is taking part in, leaving any it
+// was previously in, or just leaves when retroId is empty. The rest of the
+// retro is told that the user has arrived and the connection is sent a
+// "presence" roster of everyone there.
+func (c *Conn) Join(retroId string) {
+	h := c.hub
+
+	var changes []Envelope
+	h.mu.Lock()
+	if c.RetroId != retroId {
+		if env, ok := h.presenceChange(c, false); ok {
+			changes = append(changes, env)
+		}
+		c.RetroId = retroId
+		if env, ok := h.presenceChange(c, true); ok {
+			changes = append(changes, env)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, env := range changes {
+		h.publish(c.Context(), env)
+	}
+
+	if retroId != "" {
+		h.mu.RLock()
+		users := h.roster(retroId)
+		h.mu.RUnlock()
+
+		c.Send("", "presence", presenceData{"roster", users})
+	}
+}
+
+// Send queues a message to be sent to the connection, it waits if the queue is
+// full and returns ErrClosed if the connection has been closed.
 func (c *Conn) Send(id, op string, v interface{}) error {
-	data, err := json.Marshal(v)
+	msg, err := newMsg(id, op, v)
 	if err != nil {
 		return err
 	}
 
-	return c.send(Msg{
-		Id:   id,
-		Op:   op,
-		Data: string(data),
-	})
+	return c.send(msg)
 }
 
+// Broadcast queues a message to be sent to every connection, including those on
+// other servers sharing the broker. Connections that are not keeping up are
+// handled by the server's SlowConsumerPolicy.
 func (c *Conn) Broadcast(id, op string, v interface{}) {
-	data, err := json.Marshal(v)
+	ctx, span := tracer.Start(c.Context(), "broadcast "+op,
+		trace.WithAttributes(attribute.String("retro.id", c.RetroId)))
+	defer span.End()
+
+	msg, err := newMsg(id, op, v)
+	if err != nil {
+		return
+	}
+
+	c.hub.broadcast(ctx, msg)
+}
+
+// BroadcastRetro queues a message to be sent to every connection that has
+// joined the same retro as c.
+func (c *Conn) BroadcastRetro(id, op string, v interface{}) {
+	ctx, span := tracer.Start(c.Context(), "broadcast "+op,
+		trace.WithAttributes(attribute.String("retro.id", c.RetroId)))
+	defer span.End()
+
+	msg, err := newMsg(id, op, v)
 	if err != nil {
 		return
 	}
 
-	c.hub.broadcast(Msg{
-		Id:   id,
-		Op:   op,
-		Data: string(data),
-	})
+	c.hub.broadcastRetro(ctx, c.RetroId, msg)
 }
@@ -0,0 +1,148 @@
+package sock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// eventsTransport connects a client that receives messages as Server-Sent
+// Events. The client sends its messages by POSTing them, with the session key
+// it is given when the stream starts, and they are passed to read through
+// inbox.
+type eventsTransport struct {
+	w     http.ResponseWriter
+	rc    *http.ResponseController
+	ctx   context.Context
+	inbox chan []byte
+
+	deadline  time.Time
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// errReadTimeout is returned by read when the deadline passes. It is a
+// net.Error, so is treated the same as a websocket timing out.
+type errReadTimeout struct{}
+
+func (errReadTimeout) Error() string   { return "sock: read timeout" }
+func (errReadTimeout) Timeout() bool   { return true }
+func (errReadTimeout) Temporary() bool { return true }
+
+func (t *eventsTransport) read() ([]byte, error) {
+	timer := time.NewTimer(time.Until(t.deadline))
+	defer timer.Stop()
+
+	select {
+	case data := <-t.inbox:
+		return data, nil
+	case <-timer.C:
+		return nil, errReadTimeout{}
+	case <-t.ctx.Done():
+		return nil, io.EOF
+	case <-t.closed:
+		return nil, io.EOF
+	}
+}
+
+func (t *eventsTransport) write(data []byte, deadline time.Time) error {
+	t.rc.SetWriteDeadline(deadline)
+
+	if _, err := io.WriteString(t.w, "data: "+string(data)+"\n\n"); err != nil {
+		return err
+	}
+	return t.rc.Flush()
+}
+
+func (t *eventsTransport) setReadDeadline(deadline time.Time) {
+	t.deadline = deadline
+}
+
+func (t *eventsTransport) close() error {
+	t.closeOnce.Do(func() {
+		close(t.closed)
+	})
+	return nil
+}
+
+// deliver passes a message POSTed by the client to read, waiting until it is
+// taken or the connection or request ends.
+func (t *eventsTransport) deliver(ctx context.Context, data []byte) error {
+	select {
+	case t.inbox <- data:
+		return nil
+	case <-t.closed:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type sessionData struct {
+	Session string `json:"session"`
+}
+
+// serveEvents streams messages to the client as Server-Sent Events. The first
+// is a "session" message holding the key that the client must POST its
+// messages with.
+func (s *Server) serveEvents(w http.ResponseWriter, r *http.Request, protocol int) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	key := newSessionKey()
+	t := &eventsTransport{
+		w:      w,
+		rc:     http.NewResponseController(w),
+		ctx:    r.Context(),
+		inbox:  make(chan []byte),
+		closed: make(chan struct{}),
+	}
+
+	s.sessions.Store(key, t)
+	defer s.sessions.Delete(key)
+
+	s.serve(t, protocol, func(conn *Conn) {
+		conn.Send("", "session", sessionData{key})
+	})
+}
+
+// servePost passes a message from a client connected with serveEvents to its
+// connection.
+func (s *Server) servePost(w http.ResponseWriter, r *http.Request) {
+	v, ok := s.sessions.Load(r.URL.Query().Get("session"))
+	if !ok {
+		http.Error(w, "unknown session", http.StatusNotFound)
+		return
+	}
+	t := v.(*eventsTransport)
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, int64(s.hub.maxMessageSize)))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "message too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := t.deliver(r.Context(), data); err != nil {
+		http.Error(w, "session closed", http.StatusGone)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func newSessionKey() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -3,29 +3,91 @@
 package sock
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"strconv"
 	"sync"
-
-	"golang.org/x/net/websocket"
+	"sync/atomic"
+	"time"
 )
 
 type hub struct {
 	mu          sync.RWMutex
 	connections map[*Conn]struct{}
+
+	// lastId is used to give each connection a unique id.
+	lastId atomic.Uint64
+
+	queueSize int
+	policy    SlowConsumerPolicy
+
+	pingInterval time.Duration
+	pingTimeout  time.Duration
+
+	// maxMessageSize is the largest frame, in bytes, that will be read.
+	maxMessageSize int
+
+	// instance identifies this server to the others sharing its broker.
+	instance string
+	broker   Broker
+
+	// presence holds, for each retro, the users connected to it and the
+	// instances they are connected through.
+	presence map[string]map[string]map[string]struct{}
+
+	// presenceSeq counts the presence changes published by this server, and
+	// instances tracks what has been applied from each server and when it was
+	// last heard from.
+	presenceSeq uint64
+	instances   map[string]*instanceState
+
+	stopHeartbeat chan struct{}
+	stopOnce      sync.Once
 }
 
 func newHub() *hub {
-	return &hub{
+	h := &hub{
 		connections: map[*Conn]struct{}{},
+		queueSize:   defaultQueueSize,
+		policy:      Drop,
+
+		pingInterval: defaultPingInterval,
+		pingTimeout:  defaultPingTimeout,
+
+		maxMessageSize: defaultMaxMessageSize,
+
+		instance: newInstanceId(),
+		broker:   NewMemoryBroker(),
+		presence: map[string]map[string]map[string]struct{}{},
+
+		instances:     map[string]*instanceState{},
+		stopHeartbeat: make(chan struct{}),
 	}
+	h.broker.Subscribe(h.deliver)
+
+	return h
+}
+
+func newInstanceId() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
 }
 
 // AddConnection adds a new connection to the hub, and returns the connection.
-func (h *hub) addConnection(ws *websocket.Conn) *Conn {
+func (h *hub) addConnection(t transport, protocol int) *Conn {
 	conn := &Conn{
-		Name: "",
-		Err:  nil,
-		ws:   ws,
-		hub:  h,
+		Id:        strconv.FormatUint(h.lastId.Add(1), 10),
+		Name:      "",
+		Err:       nil,
+		hub:       h,
+		transport: t,
+		protocol:  protocol,
+		out:       make(chan Msg, h.queueSize),
+		done:      make(chan struct{}),
+		written:   make(chan struct{}),
 	}
 
 	h.mu.Lock()
@@ -35,17 +97,70 @@ func (h *hub) addConnection(ws *websocket.Conn) *Conn {
 	return conn
 }
 
+// removeConnection removes the connection from the hub, telling the rest of
+// its retro if that was the last connection for the user.
 func (h *hub) removeConnection(conn *Conn) {
 	h.mu.Lock()
+	env, changed := h.presenceChange(conn, false)
 	delete(h.connections, conn)
 	h.mu.Unlock()
+
+	conn.close()
+
+	if changed {
+		h.publish(context.Background(), env)
+	}
 }
 
-func (h *hub) broadcast(msg Msg) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
+// broadcast sends msg to every connection, on every server.
+func (h *hub) broadcast(ctx context.Context, msg Msg) {
+	h.publish(ctx, Envelope{All: true, Msg: msg})
+}
+
+// broadcastRetro sends msg to every connection that has joined retroId, on
+// every server.
+func (h *hub) broadcastRetro(ctx context.Context, retroId string, msg Msg) {
+	h.publish(ctx, Envelope{Retro: retroId, Msg: msg})
+}
+
+func (h *hub) publish(ctx context.Context, env Envelope) {
+	if err := h.broker.Publish(ctx, env); err != nil {
+		sendErrorsTotal.WithLabelValues("publish").Inc()
+		slog.Error("publish broadcast", "retroId", env.Retro, "msgOp", env.Msg.Op, "err", err)
+	}
+}
+
+// deliver queues a published message for the connections on this server that
+// it is meant for. It never waits on a connection, so a slow client can't hold
+// up the others.
+func (h *hub) deliver(env Envelope) {
+	if env.Presence != nil {
+		h.deliverPresence(env.Retro, *env.Presence)
+		return
+	}
+	if env.Heartbeat != nil {
+		h.deliverHeartbeat(*env.Heartbeat)
+		return
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if env.All {
+		for conn := range h.connections {
+			conn.offer(env.Msg)
+		}
+	} else {
+		h.offerRetro(env.Retro, env.Msg)
+	}
+}
 
-	for conn, _ := range h.connections {
-		conn.send(msg)
+// offerRetro queues msg for every connection that has joined retroId. h.mu must
+// be held.
+func (h *hub) offerRetro(retroId string, msg Msg) {
+	for conn := range h.connections {
+		if conn.RetroId == retroId {
+			conn.offer(msg)
+		}
 	}
 }
@@ -0,0 +1,44 @@
+package sock
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"time"
+)
+
+const (
+	defaultPingInterval = 30 * time.Second
+	defaultPingTimeout  = 75 * time.Second
+)
+
+// pingLoop queues a "ping" for the connection every interval until it is
+// closed. Clients reply with a "pong", so that a connection that is otherwise
+// quiet still sends something before its read deadline passes.
+func (c *Conn) pingLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.offer(Msg{Op: "ping", Data: json.RawMessage("{}")}); err == ErrClosed {
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// extendDeadline gives the client until timeout to send its next message,
+// after which reading fails and the connection is removed from the hub.
+func (c *Conn) extendDeadline(timeout time.Duration) {
+	c.transport.setReadDeadline(time.Now().Add(timeout))
+}
+
+// isTimeout reports whether err was caused by a read deadline passing.
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,97 @@
+package sock
+
+import (
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// Limit is a token bucket allowing Rate messages a second on average, in
+// bursts of up to Burst. The zero Limit allows everything.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+func (l Limit) limiter() *rate.Limiter {
+	if l.Rate <= 0 {
+		return rate.NewLimiter(rate.Inf, 0)
+	}
+
+	burst := l.Burst
+	if burst < 1 {
+		burst = 1
+	}
+	return rate.NewLimiter(rate.Limit(l.Rate), burst)
+}
+
+type opLimits struct {
+	conn, user Limit
+}
+
+var defaultLimits = opLimits{
+	conn: Limit{Rate: 10, Burst: 20},
+	user: Limit{Rate: 20, Burst: 40},
+}
+
+// rateLimiter keeps a bucket for each op on each connection, and for each op
+// for each user across all of their connections.
+type rateLimiter struct {
+	// limits holds the limits for each op, ops not listed use the entry for "".
+	limits map[string]opLimits
+
+	mu    sync.Mutex
+	users map[string]map[string]*rate.Limiter
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		limits: map[string]opLimits{"": defaultLimits},
+		users:  map[string]map[string]*rate.Limiter{},
+	}
+}
+
+func (r *rateLimiter) limitsFor(op string) opLimits {
+	if l, ok := r.limits[op]; ok {
+		return l
+	}
+	return r.limits[""]
+}
+
+// allow takes a token for op from the connection's and its user's buckets. If
+// either is empty it returns false, along with which one.
+func (r *rateLimiter) allow(conn *Conn, op string) (ok bool, scope string) {
+	limits := r.limitsFor(op)
+
+	// limiters is only used by the connection's own goroutine.
+	if conn.limiters == nil {
+		conn.limiters = map[string]*rate.Limiter{}
+	}
+	connLimiter, found := conn.limiters[op]
+	if !found {
+		connLimiter = limits.conn.limiter()
+		conn.limiters[op] = connLimiter
+	}
+	if !connLimiter.Allow() {
+		return false, "connection"
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ops, found := r.users[conn.Name]
+	if !found {
+		ops = map[string]*rate.Limiter{}
+		r.users[conn.Name] = ops
+	}
+	userLimiter, found := ops[op]
+	if !found {
+		userLimiter = limits.user.limiter()
+		ops[op] = userLimiter
+	}
+	if !userLimiter.Allow() {
+		return false, "user"
+	}
+
+	return true, ""
+}
@@ -0,0 +1,70 @@
+package sock
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	messagesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "retro_sock_messages_total",
+		Help: "Messages received, by op.",
+	}, []string{"op"})
+
+	handlerDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "retro_sock_handler_duration_seconds",
+		Help:    "Time taken to handle messages, by op.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"op"})
+
+	authFailuresTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "retro_sock_auth_failures_total",
+		Help: "Messages rejected because they failed authentication.",
+	})
+
+	sendErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "retro_sock_send_errors_total",
+		Help: "Messages that could not be sent, by reason.",
+	}, []string{"reason"})
+
+	deadConnectionsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "retro_sock_dead_connections_total",
+		Help: "Connections removed because nothing was received before the ping timeout.",
+	})
+
+	rateLimitedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "retro_sock_rate_limited_total",
+		Help: "Messages rejected for exceeding a rate limit, by op and whether the connection or user limit was hit.",
+	}, []string{"op", "scope"})
+
+	panicsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "retro_sock_handler_panics_total",
+		Help: "Handlers that panicked, by op.",
+	}, []string{"op"})
+
+	connectionsDesc = prometheus.NewDesc(
+		"retro_sock_connections",
+		"Open websocket connections, by retro. Connections that haven't joined a retro have an empty retro.",
+		[]string{"retro"}, nil)
+)
+
+// Describe implements prometheus.Collector.
+func (s *Server) Describe(ch chan<- *prometheus.Desc) {
+	ch <- connectionsDesc
+}
+
+// Collect implements prometheus.Collector, reporting the number of open
+// connections to each retro. Retros without connections aren't reported, so
+// series come and go with them.
+func (s *Server) Collect(ch chan<- prometheus.Metric) {
+	s.hub.mu.RLock()
+	counts := map[string]int{}
+	for conn := range s.hub.connections {
+		counts[conn.RetroId]++
+	}
+	s.hub.mu.RUnlock()
+
+	for retroId, n := range counts {
+		ch <- prometheus.MustNewConstMetric(connectionsDesc, prometheus.GaugeValue, float64(n), retroId)
+	}
+}
@@ -0,0 +1,79 @@
+package sock
+
+import (
+	"context"
+	"runtime/debug"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Middleware wraps a Handler, to do something before or after it, or instead
+// of it. The op being handled is available from Conn.Op.
+type Middleware func(next Handler) Handler
+
+// chain wraps handler in middleware, so that the first is called first.
+func chain(handler Handler, middleware []Middleware) Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
+
+// instrument traces and measures each op. It must come before any middleware
+// that logs, so that the logs carry the trace id.
+func instrument(next Handler) Handler {
+	return func(conn *Conn, data []byte) {
+		ctx, span := tracer.Start(context.Background(), conn.op,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("conn.id", conn.Id),
+				attribute.String("user.name", conn.Name),
+				attribute.String("retro.id", conn.RetroId)))
+
+		conn.ctx = ctx
+		defer func() {
+			conn.ctx = nil
+			span.End()
+		}()
+
+		messagesTotal.WithLabelValues(conn.op).Inc()
+		start := time.Now()
+		next(conn, data)
+		handlerDuration.WithLabelValues(conn.op).Observe(time.Since(start).Seconds())
+	}
+}
+
+// recoverPanics stops a panicking handler from taking down the connection.
+// The client is sent an "internal" error and the connection carries on.
+func recoverPanics(next Handler) Handler {
+	return func(conn *Conn, data []byte) {
+		defer func() {
+			if v := recover(); v != nil {
+				panicsTotal.WithLabelValues(conn.op).Inc()
+				trace.SpanFromContext(conn.Context()).SetStatus(codes.Error, "panic")
+				conn.Log().Error("handler panicked", "panic", v, "stack", string(debug.Stack()))
+				conn.reply("error", errorData{"internal"})
+			}
+		}()
+
+		next(conn, data)
+	}
+}
+
+// middleware rejects ops that exceed the connection's or user's limits with a
+// "rate_limited" error.
+func (r *rateLimiter) middleware(next Handler) Handler {
+	return func(conn *Conn, data []byte) {
+		if ok, scope := r.allow(conn, conn.op); !ok {
+			rateLimitedTotal.WithLabelValues(conn.op, scope).Inc()
+			conn.Log().Debug("rate limited", "scope", scope)
+			conn.reply("error", errorData{"rate_limited"})
+			return
+		}
+
+		next(conn, data)
+	}
+}
@@ -1,5 +1,7 @@
 package sock
 
+import "encoding/json"
+
 // Msg is a standard message type that should work for all the use cases required.
 type Msg struct {
 	// Id is the name for the connection that the message originated from, or an
@@ -8,16 +10,31 @@ type Msg struct {
 
 	// Auth contains parameters used to authenticate a messages origin. It is not
 	// present on messages sent from the server to a client.
-	Auth *MsgAuth `json:"auth"`
+	Auth *MsgAuth `json:"auth,omitempty"`
 
 	// Op is the name of the operation being carried out.
 	Op string `json:"op"`
 
-	// Data is anything useful, encoded in a string, hopefully in JSON.
-	Data string `json:"data"`
+	// Ref is chosen by the client to match replies to the message they are for.
+	// It is copied to any "ack" or "error" sent in reply.
+	Ref string `json:"ref,omitempty"`
+
+	// Data is anything useful, as JSON. In protocol version 1 it is sent encoded
+	// in a string.
+	Data json.RawMessage `json:"data"`
 }
 
 type MsgAuth struct {
 	Username string `json:"username"`
 	Token    string `json:"token"`
 }
+
+// newMsg creates a message for op with v encoded as its data.
+func newMsg(id, op string, v interface{}) (Msg, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return Msg{}, err
+	}
+
+	return Msg{Id: id, Op: op, Data: data}, nil
+}
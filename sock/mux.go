@@ -2,10 +2,14 @@ package sock
 
 import (
 	"errors"
+	"sync"
 
+	"go.opentelemetry.io/otel"
 	"golang.org/x/net/websocket"
 )
 
+var tracer = otel.Tracer("hawx.me/code/retro/sock")
+
 type Handler func(conn *Conn, data []byte)
 
 type Authenticator func(MsgAuth) bool
@@ -15,44 +19,102 @@ type mux struct {
 	handlers map[string]Handler
 
 	authenticate Authenticator
+	limiter      *rateLimiter
+
+	// middleware wraps every handler, after the built in middleware for
+	// tracing, metrics, panics and rate limiting.
+	middleware []Middleware
+
+	// inflight is held for reading by each running handler, closing is set
+	// once the server is shutting down and no more should be started.
+	inflight sync.RWMutex
+	closing  bool
 }
 
 func newMux() *mux {
 	return &mux{
 		handlers: map[string]Handler{},
+		limiter:  newRateLimiter(),
 	}
 }
 
-func (m *mux) handle(op string, handler Handler) {
-	m.handlers[op] = handler
+func (m *mux) handle(op string, handler Handler, middleware []Middleware) {
+	m.handlers[op] = chain(handler, middleware)
 }
 
 func (m *mux) serve(conn *Conn) error {
 	for {
+		conn.extendDeadline(conn.hub.pingTimeout)
+
 		var msg Msg
-		if err := websocket.JSON.Receive(conn.ws, &msg); err != nil {
+		if err := conn.receive(&msg); err == websocket.ErrFrameTooLarge {
+			// The rest of the frame is skipped by the next Receive.
+			messagesTotal.WithLabelValues("too_large").Inc()
+			conn.Log().Info("message too large", "max", conn.hub.maxMessageSize)
+			conn.Send("", "error", errorData{"too_large"})
+			continue
+		} else if err != nil {
 			return err
 		}
 
 		if msg.Auth == nil || !m.authenticate(*msg.Auth) {
+			authFailuresTotal.Inc()
+			conn.Log().Warn("bad auth")
 			conn.Send("", "error", errorData{"bad_auth"})
 			return errors.New("BadAuth")
 		}
 
-		conn.Name = msg.Auth.Username
+		if conn.Name != msg.Auth.Username {
+			// Other connections read Name when working out presence.
+			conn.hub.mu.Lock()
+			conn.Name = msg.Auth.Username
+			conn.hub.mu.Unlock()
+		}
+
+		if msg.Op == "pong" {
+			continue
+		}
 
 		handler, ok := m.handlers[msg.Op]
 		if !ok {
+			messagesTotal.WithLabelValues("unknown").Inc()
+			conn.Log().Debug("unknown op", "unknownOp", msg.Op)
 			continue
 		}
 
-		handler(conn, []byte(msg.Data))
+		if err := m.run(conn, msg, handler); err != nil {
+			return err
+		}
 		if conn.Err != nil {
 			return conn.Err
 		}
 	}
 }
 
+// run calls the handler for msg, wrapped in the middleware. It returns
+// ErrShuttingDown, without calling the handler, once the server is shutting
+// down.
+func (m *mux) run(conn *Conn, msg Msg, handler Handler) error {
+	m.inflight.RLock()
+	defer m.inflight.RUnlock()
+
+	if m.closing {
+		return ErrShuttingDown
+	}
+
+	conn.op = msg.Op
+	conn.ref = msg.Ref
+	defer func() {
+		conn.op = ""
+		conn.ref = ""
+	}()
+
+	middleware := append([]Middleware{instrument, recoverPanics, m.limiter.middleware}, m.middleware...)
+	chain(handler, middleware)(conn, msg.Data)
+
+	return nil
+}
+
 type errorData struct {
 	Error string `json:"error"`
 }
@@ -0,0 +1,247 @@
+package sock
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"time"
+)
+
+const (
+	heartbeatInterval = 10 * time.Second
+	heartbeatTTL      = 3 * heartbeatInterval
+)
+
+// presenceData is sent with the "presence" op. Event is "roster" when Users
+// lists everyone currently connected to the retro, or "join" or "leave" when
+// Users holds the one user that has arrived or gone.
+type presenceData struct {
+	Event string   `json:"event"`
+	Users []string `json:"users"`
+}
+
+// instanceState is what is known about a server sharing the broker.
+type instanceState struct {
+	seq  uint64
+	seen time.Time
+}
+
+// presenceChange returns the Presence to publish when conn joins or leaves its
+// retro, if it is the user's first or last connection to the retro on this
+// server. h.mu must be held for writing.
+func (h *hub) presenceChange(conn *Conn, joined bool) (Envelope, bool) {
+	if conn.RetroId == "" {
+		return Envelope{}, false
+	}
+
+	for other := range h.connections {
+		if other != conn && other.RetroId == conn.RetroId && other.Name == conn.Name {
+			return Envelope{}, false
+		}
+	}
+
+	h.presenceSeq++
+
+	return Envelope{
+		Retro: conn.RetroId,
+		Presence: &Presence{
+			Instance: h.instance,
+			Seq:      h.presenceSeq,
+			Username: conn.Name,
+			Joined:   joined,
+		},
+	}, true
+}
+
+// deliverPresence records a user joining or leaving a retro through an
+// instance, unless it has already been superseded.
+func (h *hub) deliverPresence(retroId string, p Presence) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	state := h.instanceState(p.Instance)
+	state.seen = time.Now()
+	if p.Seq <= state.seq {
+		return
+	}
+	state.seq = p.Seq
+
+	h.setPresence(retroId, p.Username, p.Instance, p.Joined)
+}
+
+// deliverHeartbeat replaces what is known about the users connected through
+// an instance with its heartbeat, then answers if it asked for heartbeats.
+func (h *hub) deliverHeartbeat(hb Heartbeat) {
+	h.mu.Lock()
+	state := h.instanceState(hb.Instance)
+	state.seen = time.Now()
+	if hb.Seq >= state.seq {
+		state.seq = hb.Seq
+		h.replacePresence(hb.Instance, hb.Retros)
+	}
+	h.mu.Unlock()
+
+	if hb.Request && hb.Instance != h.instance {
+		// Not while delivering, as a broker may deliver while publishing.
+		go h.publishHeartbeat(false)
+	}
+}
+
+// instanceState returns the state for instance, adding it if it is new. h.mu
+// must be held for writing.
+func (h *hub) instanceState(instance string) *instanceState {
+	state, ok := h.instances[instance]
+	if !ok {
+		state = &instanceState{}
+		h.instances[instance] = state
+	}
+	return state
+}
+
+// replacePresence sets the users connected through instance to those in
+// retros, a map of retro id to usernames. h.mu must be held for writing.
+func (h *hub) replacePresence(instance string, retros map[string][]string) {
+	want := map[string]map[string]bool{}
+	for retroId, usernames := range retros {
+		want[retroId] = map[string]bool{}
+		for _, username := range usernames {
+			want[retroId][username] = true
+		}
+	}
+
+	for retroId, users := range h.presence {
+		for username, instances := range users {
+			if _, ok := instances[instance]; ok && !want[retroId][username] {
+				h.setPresence(retroId, username, instance, false)
+			}
+		}
+	}
+
+	for retroId, usernames := range want {
+		for username := range usernames {
+			h.setPresence(retroId, username, instance, true)
+		}
+	}
+}
+
+// setPresence records whether a user is connected to a retro through an
+// instance. The retro's connections on this server are told when that means
+// the user has arrived, or has gone from every instance. h.mu must be held for
+// writing.
+func (h *hub) setPresence(retroId, username, instance string, present bool) {
+	users, ok := h.presence[retroId]
+	if !ok {
+		users = map[string]map[string]struct{}{}
+		h.presence[retroId] = users
+	}
+
+	instances, ok := users[username]
+	if !ok {
+		instances = map[string]struct{}{}
+		users[username] = instances
+	}
+
+	wasPresent := len(instances) > 0
+	if present {
+		instances[instance] = struct{}{}
+	} else {
+		delete(instances, instance)
+	}
+	isPresent := len(instances) > 0
+
+	if !isPresent {
+		delete(users, username)
+		if len(users) == 0 {
+			delete(h.presence, retroId)
+		}
+	}
+
+	if wasPresent == isPresent {
+		return
+	}
+
+	event := "leave"
+	if isPresent {
+		event = "join"
+	}
+	msg, err := newMsg("", "presence", presenceData{event, []string{username}})
+	if err != nil {
+		return
+	}
+
+	h.offerRetro(retroId, msg)
+}
+
+// startHeartbeat asks the other servers sharing the broker who is connected
+// through them, then publishes this server's heartbeat every heartbeatInterval
+// until stopped.
+func (h *hub) startHeartbeat() {
+	h.publishHeartbeat(true)
+
+	go func() {
+		ticker := time.NewTicker(heartbeatInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-h.stopHeartbeat:
+				return
+			case <-ticker.C:
+				h.publishHeartbeat(false)
+				h.expireInstances(time.Now().Add(-heartbeatTTL))
+			}
+		}
+	}()
+}
+
+func (h *hub) stopHeartbeats() {
+	h.stopOnce.Do(func() { close(h.stopHeartbeat) })
+}
+
+// publishHeartbeat publishes the users connected through this server.
+func (h *hub) publishHeartbeat(request bool) {
+	h.mu.RLock()
+	retros := map[string][]string{}
+	seen := map[string]map[string]bool{}
+	for conn := range h.connections {
+		if conn.RetroId == "" || seen[conn.RetroId][conn.Name] {
+			continue
+		}
+		if seen[conn.RetroId] == nil {
+			seen[conn.RetroId] = map[string]bool{}
+		}
+		seen[conn.RetroId][conn.Name] = true
+		retros[conn.RetroId] = append(retros[conn.RetroId], conn.Name)
+	}
+	hb := Heartbeat{Instance: h.instance, Seq: h.presenceSeq, Retros: retros, Request: request}
+	h.mu.RUnlock()
+
+	h.publish(context.Background(), Envelope{Heartbeat: &hb})
+}
+
+// expireInstances removes the users connected through any other server that
+// hasn't been heard from since before.
+func (h *hub) expireInstances(before time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for instance, state := range h.instances {
+		if instance != h.instance && state.seen.Before(before) {
+			slog.Warn("instance expired", "instance", instance, "lastSeen", state.seen)
+			h.replacePresence(instance, nil)
+			delete(h.instances, instance)
+		}
+	}
+}
+
+// roster returns the users connected to retroId through any instance, in name
+// order. h.mu must be held.
+func (h *hub) roster(retroId string) []string {
+	users := []string{}
+	for username := range h.presence[retroId] {
+		users = append(users, username)
+	}
+
+	sort.Strings(users)
+	return users
+}
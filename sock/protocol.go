@@ -0,0 +1,66 @@
+package sock
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// The protocol versions that clients can ask for by connecting with a
+// "protocol" query parameter. Clients that don't ask get version 1, where
+// Msg.Data is sent as a string holding JSON. In version 2 it is the JSON
+// itself.
+const (
+	ProtocolV1 = 1
+	ProtocolV2 = 2
+)
+
+// msgV1 is a Msg as it is sent in protocol version 1.
+type msgV1 struct {
+	Id   string   `json:"id"`
+	Auth *MsgAuth `json:"auth"`
+	Op   string   `json:"op"`
+	Ref  string   `json:"ref,omitempty"`
+	Data string   `json:"data"`
+}
+
+// protocolVersion returns the version of the protocol the client asked for,
+// or false if it isn't one that is supported.
+func protocolVersion(r *http.Request) (int, bool) {
+	switch r.URL.Query().Get("protocol") {
+	case "", "1":
+		return ProtocolV1, true
+	case "2":
+		return ProtocolV2, true
+	default:
+		return 0, false
+	}
+}
+
+// receive reads the next message from the client.
+func (c *Conn) receive(msg *Msg) error {
+	data, err := c.transport.read()
+	if err != nil {
+		return err
+	}
+
+	if c.protocol == ProtocolV2 {
+		return json.Unmarshal(data, msg)
+	}
+
+	var v1 msgV1
+	if err := json.Unmarshal(data, &v1); err != nil {
+		return err
+	}
+
+	*msg = Msg{Id: v1.Id, Auth: v1.Auth, Op: v1.Op, Ref: v1.Ref, Data: json.RawMessage(v1.Data)}
+	return nil
+}
+
+// encode returns msg in the form it should be sent to the client.
+func (c *Conn) encode(msg Msg) ([]byte, error) {
+	if c.protocol == ProtocolV2 {
+		return json.Marshal(msg)
+	}
+
+	return json.Marshal(msgV1{Id: msg.Id, Auth: msg.Auth, Op: msg.Op, Ref: msg.Ref, Data: string(msg.Data)})
+}
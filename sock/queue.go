@@ -0,0 +1,137 @@
+package sock
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+)
+
+var (
+	// ErrClosed is returned when sending to a connection that has been closed.
+	ErrClosed = errors.New("sock: connection closed")
+
+	// ErrQueueFull is returned when a message can't be queued for a connection
+	// because it is not reading them quickly enough.
+	ErrQueueFull = errors.New("sock: send queue full")
+)
+
+// SlowConsumerPolicy decides what happens when a broadcast can't be queued for
+// a connection because its send queue is full.
+type SlowConsumerPolicy int
+
+const (
+	// Drop discards the message for that connection only.
+	Drop SlowConsumerPolicy = iota
+
+	// Disconnect closes the connection, the client is expected to reconnect
+	// and rejoin to get back in sync.
+	Disconnect
+)
+
+const (
+	defaultQueueSize = 256
+
+	// writeTimeout is how long a single message can take to write before the
+	// connection is considered dead.
+	writeTimeout = 10 * time.Second
+)
+
+// send queues msg to be written to the connection, waiting if the queue is
+// full. It is used to reply to the connection's own messages, so only slows
+// down the client that is not keeping up.
+func (c *Conn) send(msg Msg) error {
+	select {
+	case <-c.done:
+		return ErrClosed
+	default:
+	}
+
+	select {
+	case c.out <- msg:
+		return nil
+	case <-c.done:
+		return ErrClosed
+	}
+}
+
+// offer queues msg to be written to the connection without waiting. If the
+// queue is full the hub's SlowConsumerPolicy is applied. As offer is called
+// from other connections' goroutines it must only log the immutable Id.
+func (c *Conn) offer(msg Msg) error {
+	select {
+	case <-c.done:
+		return ErrClosed
+	default:
+	}
+
+	select {
+	case c.out <- msg:
+		return nil
+	default:
+	}
+
+	sendErrorsTotal.WithLabelValues("queue_full").Inc()
+	if c.hub.policy == Disconnect {
+		slog.Warn("send queue full, disconnecting", "connId", c.Id)
+		c.close()
+	} else {
+		slog.Debug("send queue full, dropping message", "connId", c.Id, "msgOp", msg.Op)
+	}
+
+	return ErrQueueFull
+}
+
+// writeLoop writes queued messages to the client until the connection is
+// closed. Any messages still queued are then written, as long as that can be
+// done quickly, before the transport is closed and written is closed.
+func (c *Conn) writeLoop() {
+	defer close(c.written)
+	defer c.transport.close()
+
+	for {
+		select {
+		case msg := <-c.out:
+			if err := c.write(msg, time.Now().Add(writeTimeout)); err != nil {
+				c.close()
+				return
+			}
+
+		case <-c.done:
+			deadline := time.Now().Add(time.Second)
+			for {
+				select {
+				case msg := <-c.out:
+					if err := c.write(msg, deadline); err != nil {
+						return
+					}
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (c *Conn) write(msg Msg, deadline time.Time) error {
+	data, err := c.encode(msg)
+	if err != nil {
+		sendErrorsTotal.WithLabelValues("encode").Inc()
+		slog.Warn("encode failed", "connId", c.Id, "msgOp", msg.Op, "err", err)
+		return nil
+	}
+
+	if err := c.transport.write(data, deadline); err != nil {
+		sendErrorsTotal.WithLabelValues("write").Inc()
+		slog.Debug("write failed", "connId", c.Id, "err", err)
+		return err
+	}
+
+	return nil
+}
+
+// close stops the connection, it is safe to call more than once.
+func (c *Conn) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+}
@@ -0,0 +1,67 @@
+package sock
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisBroker passes broadcasts between servers using Redis pub/sub on a
+// single channel.
+type RedisBroker struct {
+	client  *redis.Client
+	channel string
+	sub     *redis.PubSub
+}
+
+func NewRedisBroker(addr, password, channel string) *RedisBroker {
+	return &RedisBroker{
+		client:  redis.NewClient(&redis.Options{Addr: addr, Password: password}),
+		channel: channel,
+	}
+}
+
+func (b *RedisBroker) Publish(ctx context.Context, env Envelope) error {
+	data, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+
+	return b.client.Publish(ctx, b.channel, data).Err()
+}
+
+func (b *RedisBroker) Subscribe(deliver func(Envelope)) error {
+	ctx := context.Background()
+
+	b.sub = b.client.Subscribe(ctx, b.channel)
+	// Wait for the subscription to be confirmed, so nothing published after
+	// Subscribe returns is missed.
+	if _, err := b.sub.Receive(ctx); err != nil {
+		b.sub.Close()
+		return err
+	}
+
+	go func() {
+		for m := range b.sub.Channel() {
+			var env Envelope
+			if err := json.Unmarshal([]byte(m.Payload), &env); err != nil {
+				slog.Warn("decode broadcast", "err", err)
+				continue
+			}
+
+			deliver(env)
+		}
+	}()
+
+	return nil
+}
+
+func (b *RedisBroker) Close() error {
+	if b.sub != nil {
+		b.sub.Close()
+	}
+
+	return b.client.Close()
+}
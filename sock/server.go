@@ -1,9 +1,13 @@
 package sock
 
 import (
+	"context"
 	"io"
-	"log"
 	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"golang.org/x/net/websocket"
 )
@@ -11,6 +15,12 @@ import (
 type Server struct {
 	hub *hub
 	mux *mux
+
+	// closing is set by Shutdown, after which new connections are refused.
+	closing atomic.Bool
+
+	// sessions holds the event stream connections, by their session key.
+	sessions sync.Map
 }
 
 func NewServer() *Server {
@@ -20,23 +30,148 @@ func NewServer() *Server {
 	}
 }
 
+// ServeHTTP accepts clients connecting over a websocket, or for clients that
+// can't use websockets receiving messages as Server-Sent Events and sending
+// them with POST requests.
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	websocket.Handler(s.serve).ServeHTTP(w, r)
+	if r.Method == http.MethodPost {
+		s.servePost(w, r)
+		return
+	}
+
+	if s.closing.Load() {
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	protocol, ok := protocolVersion(r)
+	if !ok {
+		http.Error(w, "unsupported protocol", http.StatusBadRequest)
+		return
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		s.serveEvents(w, r, protocol)
+		return
+	}
+
+	websocket.Handler(func(ws *websocket.Conn) {
+		ws.MaxPayloadBytes = s.hub.maxMessageSize
+		s.serve(wsTransport{ws}, protocol, nil)
+	}).ServeHTTP(w, r)
 }
 
-func (s *Server) serve(ws *websocket.Conn) {
-	conn := s.hub.addConnection(ws)
-	defer s.hub.removeConnection(conn)
+// serve handles the messages from a client until it disconnects. If ready is
+// given it is called once the connection has been added to the hub.
+func (s *Server) serve(t transport, protocol int, ready func(*Conn)) {
+	conn := s.hub.addConnection(t, protocol)
+
+	// Shutdown may have closed the open connections just before this one was
+	// added.
+	if s.closing.Load() {
+		s.hub.removeConnection(conn)
+		t.close()
+		return
+	}
+
+	go conn.writeLoop()
+	go conn.pingLoop(s.hub.pingInterval)
+	defer func() {
+		s.hub.removeConnection(conn)
+		<-conn.written
+	}()
+
+	if ready != nil {
+		ready(conn)
+	}
+
+	conn.Log().Debug("connected", "protocol", protocol)
+	err := s.mux.serve(conn)
+	switch {
+	case err == io.EOF:
+		conn.Log().Debug("disconnected")
+	case s.closing.Load():
+		conn.Log().Debug("disconnected for shutdown")
+	case isTimeout(err):
+		deadConnectionsTotal.Inc()
+		conn.Log().Info("connection timed out", "timeout", s.hub.pingTimeout)
+	default:
+		conn.Log().Warn("disconnected", "err", err)
+	}
+}
 
-	if err := s.mux.serve(conn); err != io.EOF {
-		log.Println(err)
+// BroadcastRetro queues a message to be sent to every connection that has
+// joined retroId. It is for messages that don't come from handling an op, which
+// should use Conn.BroadcastRetro.
+func (s *Server) BroadcastRetro(retroId, id, op string, v interface{}) {
+	msg, err := newMsg(id, op, v)
+	if err != nil {
+		return
 	}
+
+	s.hub.broadcastRetro(context.Background(), retroId, msg)
 }
 
-func (s *Server) Handle(op string, handler Handler) {
-	s.mux.handle(op, handler)
+// RateLimit sets the limits on how often op can be sent by a single connection,
+// and by a user across all of their connections to this server. When op is
+// empty it sets the limits for every op that doesn't have its own. It must be
+// called before serving any connections.
+func (s *Server) RateLimit(op string, perConn, perUser Limit) {
+	s.mux.limiter.limits[op] = opLimits{conn: perConn, user: perUser}
+}
+
+// Handle registers the handler for op, wrapped in any middleware given. These
+// run inside the middleware added with Use.
+func (s *Server) Handle(op string, handler Handler, middleware ...Middleware) {
+	s.mux.handle(op, handler, middleware)
+}
+
+// Use adds middleware that wraps the handler for every op, in the order given.
+// It must be called before serving any connections.
+func (s *Server) Use(middleware ...Middleware) {
+	s.mux.middleware = append(s.mux.middleware, middleware...)
 }
 
 func (s *Server) Auth(authenticate Authenticator) {
 	s.mux.authenticate = authenticate
 }
+
+// SendQueue sets the number of messages that can be waiting to be sent to each
+// connection, and what to do when a connection's queue is full. It must be
+// called before serving any connections.
+func (s *Server) SendQueue(size int, policy SlowConsumerPolicy) {
+	s.hub.queueSize = size
+	s.hub.policy = policy
+}
+
+const defaultMaxMessageSize = 16 << 10
+
+// MaxMessageSize sets the largest message, in bytes, that a client can send.
+// Larger messages are skipped and the client sent a "too_large" error. It must
+// be called before serving any connections.
+func (s *Server) MaxMessageSize(n int) {
+	s.hub.maxMessageSize = n
+}
+
+// Keepalive sets how often connections are sent a "ping", and how long a
+// connection can go without sending anything before it is considered dead and
+// removed. The timeout should allow for a few missed pings. It must be called
+// before serving any connections.
+func (s *Server) Keepalive(interval, timeout time.Duration) {
+	s.hub.pingInterval = interval
+	s.hub.pingTimeout = timeout
+}
+
+// Broker passes broadcasts through b, so that they reach connections on every
+// server subscribed to it. The servers publish heartbeats through it so that
+// users connected through a server that goes away are removed from presence.
+// It must be called before serving any connections.
+func (s *Server) Broker(b Broker) error {
+	if err := b.Subscribe(s.hub.deliver); err != nil {
+		return err
+	}
+
+	s.hub.broker = b
+	s.hub.startHeartbeat()
+	return nil
+}
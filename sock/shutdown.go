@@ -0,0 +1,84 @@
+package sock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// ErrShuttingDown is returned for messages received once the server has
+// started shutting down.
+var ErrShuttingDown = errors.New("sock: server shutting down")
+
+// Shutdown stops the server accepting connections and tells every open
+// connection, with a "server_shutdown" message, to reconnect elsewhere. It then
+// waits for any ops being handled to finish before closing the connections. If
+// ctx ends first the connections are closed without waiting and ctx's error is
+// returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.closing.Store(true)
+	s.hub.stopHeartbeats()
+
+	s.hub.mu.RLock()
+	for conn := range s.hub.connections {
+		conn.offer(Msg{Op: "server_shutdown", Data: json.RawMessage("{}")})
+	}
+	s.hub.mu.RUnlock()
+
+	err := s.mux.drain(ctx)
+
+	s.hub.mu.RLock()
+	for conn := range s.hub.connections {
+		conn.close()
+	}
+	s.hub.mu.RUnlock()
+
+	if werr := s.hub.waitEmpty(ctx); err == nil {
+		err = werr
+	}
+
+	return err
+}
+
+// drain waits for the handlers currently running to return, and stops any
+// more from starting.
+func (m *mux) drain(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		m.inflight.Lock()
+		m.closing = true
+		m.inflight.Unlock()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// waitEmpty waits for every connection to have finished writing its queue and
+// been removed.
+func (h *hub) waitEmpty(ctx context.Context) error {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		h.mu.RLock()
+		n := len(h.connections)
+		h.mu.RUnlock()
+
+		if n == 0 {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package sock
+
+import (
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// A transport carries encoded messages between a Conn and its client, so that
+// nothing else needs to know how the client is connected.
+type transport interface {
+	// read returns the next message from the client.
+	read() ([]byte, error)
+
+	// write sends a message to the client, giving up at deadline.
+	write(data []byte, deadline time.Time) error
+
+	// setReadDeadline makes read fail if nothing arrives before t.
+	setReadDeadline(t time.Time)
+
+	close() error
+}
+
+// wsTransport connects a client over a websocket.
+type wsTransport struct {
+	ws *websocket.Conn
+}
+
+func (t wsTransport) read() ([]byte, error) {
+	var data []byte
+	err := websocket.Message.Receive(t.ws, &data)
+	return data, err
+}
+
+func (t wsTransport) write(data []byte, deadline time.Time) error {
+	t.ws.SetWriteDeadline(deadline)
+	return websocket.Message.Send(t.ws, string(data))
+}
+
+func (t wsTransport) setReadDeadline(deadline time.Time) {
+	t.ws.SetReadDeadline(deadline)
+}
+
+func (t wsTransport) close() error {
+	return t.ws.Close()
+}
@@ -0,0 +1,85 @@
+package sock
+
+import (
+	"encoding/json"
+	"errors"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ClientError is an error that the client should be told about. ClientData is
+// sent as the data of an "error" message, and should have an "error" field
+// naming the problem.
+type ClientError interface {
+	error
+	ClientData() interface{}
+}
+
+// Error is a ClientError that only names the problem, such as "not_found".
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+func (e Error) ClientData() interface{} {
+	return errorData{string(e)}
+}
+
+// HandleFunc registers a handler for op that is passed the message's data
+// decoded into T.
+//
+// When decoding or the handler fail, the client is sent an "error": the
+// ClientData for a ClientError, or "bad_request" or "internal". Otherwise, if
+// the message had a Ref, the client is sent an "ack" with the handler's result.
+func HandleFunc[T, R any](s *Server, op string, handler func(conn *Conn, args T) (R, error), middleware ...Middleware) {
+	s.Handle(op, func(conn *Conn, data []byte) {
+		var args T
+		if len(data) > 0 {
+			if err := json.Unmarshal(data, &args); err != nil {
+				conn.Log().Info("decode args", "err", err)
+				conn.reply("error", errorData{"bad_request"})
+				return
+			}
+		}
+
+		result, err := handler(conn, args)
+		if err != nil {
+			conn.Fail(err)
+			return
+		}
+
+		if conn.ref != "" {
+			conn.reply("ack", result)
+		}
+	}, middleware...)
+}
+
+// Fail logs err and tells the client, with an "error" carrying the Ref of the
+// message being handled, hiding the details unless it is a ClientError. It can
+// be used by middleware to reject a message.
+func (c *Conn) Fail(err error) {
+	var clientErr ClientError
+	if errors.As(err, &clientErr) {
+		c.Log().Info("op rejected", "err", err)
+		c.reply("error", clientErr.ClientData())
+		return
+	}
+
+	trace.SpanFromContext(c.Context()).SetStatus(codes.Error, err.Error())
+	c.Log().Error("op failed", "err", err)
+	c.reply("error", errorData{"internal"})
+}
+
+// reply sends a message in response to the one being handled, carrying its
+// Ref so the client can match them up.
+func (c *Conn) reply(op string, v interface{}) error {
+	msg, err := newMsg("", op, v)
+	if err != nil {
+		return err
+	}
+	msg.Ref = c.ref
+
+	return c.send(msg)
+}
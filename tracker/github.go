@@ -0,0 +1,89 @@
+package tracker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// GitHub creates issues using the GitHub Issues API.
+type GitHub struct {
+	// BaseURL is the root of the API, this defaults to https://api.github.com.
+	BaseURL string
+
+	// Token is a personal access token with permission to create issues.
+	Token string
+
+	// Repository is the "owner/name" of the repository to create issues in.
+	Repository string
+
+	// Client is used to make requests, http.DefaultClient is used if nil.
+	Client *http.Client
+}
+
+func (g *GitHub) Create(ctx context.Context, issue Issue) (Ref, error) {
+	body, err := json.Marshal(struct {
+		Title string `json:"title"`
+		Body  string `json:"body"`
+	}{issue.Title, issue.Body})
+	if err != nil {
+		return Ref{}, err
+	}
+
+	resp, err := g.do(ctx, "POST", "/repos/"+g.Repository+"/issues", bytes.NewReader(body))
+	if err != nil {
+		return Ref{}, err
+	}
+	defer resp.Body.Close()
+
+	var data struct {
+		Number  int    `json:"number"`
+		HTMLURL string `json:"html_url"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return Ref{}, err
+	}
+
+	return Ref{Key: strconv.Itoa(data.Number), URL: data.HTMLURL}, nil
+}
+
+func (g *GitHub) Closed(ctx context.Context, key string) (bool, error) {
+	resp, err := g.do(ctx, "GET", "/repos/"+g.Repository+"/issues/"+key, nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	var data struct {
+		State string `json:"state"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return false, err
+	}
+
+	return data.State == "closed", nil
+}
+
+func (g *GitHub) do(ctx context.Context, method, path string, body io.Reader) (*http.Response, error) {
+	baseURL := g.BaseURL
+	if baseURL == "" {
+		baseURL = "https://api.github.com"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(baseURL, "/")+path, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "token "+g.Token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	return send(g.Client, req)
+}
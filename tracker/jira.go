@@ -0,0 +1,115 @@
+package tracker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Jira creates issues using the Jira REST API.
+type Jira struct {
+	// BaseURL is the root of the Jira instance, e.g. https://example.atlassian.net.
+	BaseURL string
+
+	// Username and Token are used for basic authentication; for Jira Cloud the
+	// token is an API token.
+	Username string
+	Token    string
+
+	// Project is the key of the project to create issues in.
+	Project string
+
+	// IssueType is the name of the type of issue to create, this defaults to
+	// "Task".
+	IssueType string
+
+	// Client is used to make requests, http.DefaultClient is used if nil.
+	Client *http.Client
+}
+
+func (j *Jira) Create(ctx context.Context, issue Issue) (Ref, error) {
+	issueType := j.IssueType
+	if issueType == "" {
+		issueType = "Task"
+	}
+
+	type named struct {
+		Key  string `json:"key,omitempty"`
+		Name string `json:"name,omitempty"`
+	}
+
+	var req struct {
+		Fields struct {
+			Project     named  `json:"project"`
+			Summary     string `json:"summary"`
+			Description string `json:"description"`
+			IssueType   named  `json:"issuetype"`
+		} `json:"fields"`
+	}
+	req.Fields.Project.Key = j.Project
+	req.Fields.Summary = issue.Title
+	req.Fields.Description = issue.Body
+	req.Fields.IssueType.Name = issueType
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return Ref{}, err
+	}
+
+	resp, err := j.do(ctx, "POST", "/rest/api/2/issue", bytes.NewReader(body))
+	if err != nil {
+		return Ref{}, err
+	}
+	defer resp.Body.Close()
+
+	var data struct {
+		Key string `json:"key"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return Ref{}, err
+	}
+
+	return Ref{Key: data.Key, URL: strings.TrimSuffix(j.BaseURL, "/") + "/browse/" + data.Key}, nil
+}
+
+func (j *Jira) Closed(ctx context.Context, key string) (bool, error) {
+	resp, err := j.do(ctx, "GET", "/rest/api/2/issue/"+url.PathEscape(key)+"?fields=status", nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	var data struct {
+		Fields struct {
+			Status struct {
+				StatusCategory struct {
+					Key string `json:"key"`
+				} `json:"statusCategory"`
+			} `json:"status"`
+		} `json:"fields"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return false, err
+	}
+
+	return data.Fields.Status.StatusCategory.Key == "done", nil
+}
+
+func (j *Jira) do(ctx context.Context, method, path string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(j.BaseURL, "/")+path, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(j.Username, j.Token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	return send(j.Client, req)
+}
@@ -0,0 +1,64 @@
+// Package tracker creates issues in external issue trackers for the action
+// items agreed in a retro, and reads back whether they have been closed.
+package tracker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// Issue is the information used to create a new issue.
+type Issue struct {
+	Title string
+	Body  string
+}
+
+// Ref identifies an issue created in a tracker.
+type Ref struct {
+	// Key is the tracker's identifier for the issue, for GitHub this is the
+	// issue number and for Jira the issue key (e.g. "RET-12").
+	Key string
+
+	// URL is a link to the issue that can be opened in a browser.
+	URL string
+}
+
+// Tracker is implemented by each supported issue tracker.
+type Tracker interface {
+	// Create opens a new issue.
+	Create(ctx context.Context, issue Issue) (Ref, error)
+
+	// Closed returns true when the issue with the given key has been closed.
+	Closed(ctx context.Context, key string) (bool, error)
+}
+
+type statusError struct {
+	method string
+	url    string
+	code   int
+}
+
+func (e statusError) Error() string {
+	return fmt.Sprintf("tracker: %s %s returned %d", e.method, e.url, e.code)
+}
+
+// send makes the request with client, or http.DefaultClient if nil, and
+// returns an error for any non-2xx response.
+func send(client *http.Client, req *http.Request) (*http.Response, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, statusError{req.Method, req.URL.String(), resp.StatusCode}
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"hawx.me/code/retro/sock"
+)
+
+const (
+	// typingInterval is the least time between typing messages being passed on
+	// for a user in a column, anything more frequent is dropped.
+	typingInterval = time.Second
+
+	// typingTimeout is how long after the last typing message a user is said
+	// to have stopped.
+	typingTimeout = 5 * time.Second
+)
+
+type typingData struct {
+	ColumnId string `json:"columnId"`
+	Typing   bool   `json:"typing"`
+}
+
+type typist struct {
+	retroId, columnId, username string
+}
+
+type typingState struct {
+	seen  time.Time
+	sent  time.Time
+	timer *time.Timer
+}
+
+// typingTracker passes typing indicators on to a retro. They are never stored,
+// and once a user stops sending them the retro is told they have stopped.
+type typingTracker struct {
+	server *sock.Server
+
+	mu     sync.Mutex
+	typing map[typist]*typingState
+}
+
+func newTypingTracker(server *sock.Server) *typingTracker {
+	return &typingTracker{
+		server: server,
+		typing: map[typist]*typingState{},
+	}
+}
+
+// Typing records that username is typing in the column, or has stopped.
+func (t *typingTracker) Typing(retroId, columnId, username string, typing bool) {
+	key := typist{retroId, columnId, username}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state, ok := t.typing[key]
+	if !typing {
+		if ok {
+			t.stop(key, state)
+		}
+		return
+	}
+
+	if !ok {
+		state = &typingState{
+			timer: time.AfterFunc(typingTimeout, func() { t.expire(key) }),
+		}
+		t.typing[key] = state
+	} else {
+		state.timer.Reset(typingTimeout)
+	}
+	state.seen = time.Now()
+
+	if time.Since(state.sent) < typingInterval {
+		return
+	}
+	state.sent = time.Now()
+	t.server.BroadcastRetro(retroId, username, "typing", typingData{columnId, true})
+}
+
+func (t *typingTracker) expire(key typist) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// The timer may have fired just as another message arrived and reset it.
+	if state, ok := t.typing[key]; ok && time.Since(state.seen) >= typingTimeout {
+		t.stop(key, state)
+	}
+}
+
+// stop must be called with t.mu held.
+func (t *typingTracker) stop(key typist, state *typingState) {
+	state.timer.Stop()
+	delete(t.typing, key)
+	t.server.BroadcastRetro(key.retroId, key.username, "typing", typingData{key.columnId, false})
+}
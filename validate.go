@@ -0,0 +1,147 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+	"unicode/utf8"
+
+	"hawx.me/code/retro/database"
+)
+
+// inputLimits bounds what clients can send in the arguments to an op.
+type inputLimits struct {
+	TextLength int
+	NameLength int
+	ListLength int
+}
+
+var defaultInputLimits = inputLimits{
+	TextLength: 2000,
+	NameLength: 100,
+	ListLength: 50,
+}
+
+// fieldError is returned when an argument is rejected. Reason is one of
+// "required", "too_long", "too_many", "unknown" or "invalid".
+type fieldError struct {
+	Field  string
+	Reason string
+	Max    int
+}
+
+func (e *fieldError) Error() string {
+	return e.Field + ": " + e.Reason
+}
+
+type invalidData struct {
+	Error  string `json:"error"`
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+	Max    int    `json:"max,omitempty"`
+}
+
+// ClientData implements sock.ClientError, so the client is told which field
+// was wrong.
+func (e *fieldError) ClientData() interface{} {
+	return invalidData{"invalid", e.Field, e.Reason, e.Max}
+}
+
+// firstError returns the first non-nil error.
+func firstError(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l inputLimits) text(field, s string) error {
+	return checkLength(field, s, l.TextLength)
+}
+
+func (l inputLimits) name(field, s string) error {
+	return checkLength(field, s, l.NameLength)
+}
+
+// optionalName is like name but allows s to be empty.
+func (l inputLimits) optionalName(field, s string) error {
+	if s == "" {
+		return nil
+	}
+	return l.name(field, s)
+}
+
+func checkLength(field, s string, max int) error {
+	if strings.TrimSpace(s) == "" {
+		return &fieldError{Field: field, Reason: "required"}
+	}
+	if utf8.RuneCountInString(s) > max {
+		return &fieldError{Field: field, Reason: "too_long", Max: max}
+	}
+	return nil
+}
+
+// names checks the length of the list and of each name in it.
+func (l inputLimits) names(field string, list []string) error {
+	if len(list) > l.ListLength {
+		return &fieldError{Field: field, Reason: "too_many", Max: l.ListLength}
+	}
+	for _, s := range list {
+		if err := l.name(field, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// users checks the list as for names, and that each user exists.
+func (l inputLimits) users(db *database.Database, field string, list []string) error {
+	if err := l.names(field, list); err != nil {
+		return err
+	}
+	for _, username := range list {
+		if _, err := db.GetUser(username); err == sql.ErrNoRows {
+			return &fieldError{Field: field, Reason: "unknown"}
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func oneOf(field, s string, allowed ...string) error {
+	for _, a := range allowed {
+		if s == a {
+			return nil
+		}
+	}
+	return &fieldError{Field: field, Reason: "invalid"}
+}
+
+func atLeast(field string, n, min int) error {
+	if n < min {
+		return &fieldError{Field: field, Reason: "invalid"}
+	}
+	return nil
+}
+
+// inRetro checks that id, found using lookup, belongs to retroId.
+func inRetro(field, id, retroId string, lookup func(string) (string, error)) error {
+	if id == "" {
+		return &fieldError{Field: field, Reason: "required"}
+	}
+
+	found, err := lookup(id)
+	if err == sql.ErrNoRows || (err == nil && found != retroId) {
+		return &fieldError{Field: field, Reason: "unknown"}
+	}
+	return err
+}
+
+func columnRetro(db *database.Database) func(string) (string, error) {
+	return func(id string) (string, error) {
+		column, err := db.GetColumn(id)
+		return column.Retro, err
+	}
+}